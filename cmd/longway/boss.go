@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+type bossKind int
+
+const (
+	bossAnthem bossKind = iota
+	bossMedley
+	bossSetlist
+)
+
+const (
+	bossSetLength     = 3
+	anthemCandidates  = 5
+	anthemMinimumEpic = 300
+)
+
+// bossRosters lists which encounters each act can roll. Later acts lean on
+// single showpiece songs; the opener favours stamina over difficulty.
+var bossRosters = map[int][]bossKind{
+	1: {bossSetlist, bossMedley},
+	2: {bossMedley, bossSetlist, bossAnthem},
+	3: {bossAnthem, bossMedley},
+}
+
+// bossRule is a boss-specific win condition: every song must reach minEach
+// stars and the set must total at least minTotal.
+type bossRule struct {
+	kind     bossKind
+	minEach  int
+	minTotal int
+}
+
+func (r bossRule) met(stars []int) bool {
+	if len(stars) == 0 {
+		return false
+	}
+	total := 0
+	for _, s := range stars {
+		if s < r.minEach {
+			return false
+		}
+		total += s
+	}
+	return total >= r.minTotal
+}
+
+func (r bossRule) summary() string {
+	switch {
+	case r.minTotal > 0:
+		return fmt.Sprintf("Win: at least %d★ across the set.", r.minTotal)
+	case r.kind == bossAnthem:
+		return fmt.Sprintf("Win: %d★ or better.", r.minEach)
+	default:
+		return fmt.Sprintf("Win: %d★ or better on every song.", r.minEach)
+	}
+}
+
+func rosterForAct(actIndex int) []bossKind {
+	if roster, ok := bossRosters[actIndex]; ok {
+		return roster
+	}
+	return bossRosters[totalActs]
+}
+
+// assignBoss fills the act's last row. Bosses prefer songs the run has not
+// offered yet and mark their own, so later elites and bosses skip them.
+func assignBoss(a *act, seed int64, songs []song, used map[string]bool) {
+	last := a.rows[len(a.rows)-1]
+	actSongs := applyActDifficultyConstraints(a.index, songs)
+	rng := newMulberry32(sideSeed(seed, a.index, bossStream))
+	for i := range last {
+		last[i].challenge = newBossChallenge(a.index, freshSongs(actSongs, used), rng)
+		markUsed(used, last[i].challenge.songs)
+	}
+}
+
+// newBossChallenge rolls an encounter from the act's roster, skipping any the
+// catalog cannot fill, and falls back to a lone anthem.
+func newBossChallenge(actIndex int, songs []song, rng *mulberry32) *challenge {
+	roster := rosterForAct(actIndex)
+	for _, idx := range rng.shuffleOrder(len(roster)) {
+		var c *challenge
+		switch roster[idx] {
+		case bossAnthem:
+			c = newAnthemBoss(actIndex, songs, rng)
+		case bossMedley:
+			c = newMedleyBoss(actIndex, songs, rng)
+		case bossSetlist:
+			c = newSetlistBoss(actIndex, songs, rng)
+		}
+		if c != nil {
+			return c
+		}
+	}
+	if c := newAnthemBoss(actIndex, songs, rng); c != nil {
+		return c
+	}
+	return &challenge{
+		id:          "boss-anthem",
+		kind:        challengeBoss,
+		name:        "The Anthem",
+		summary:     "One legendary song stands between you and the next act.",
+		songs:       []song{fallbackSong()},
+		selectCount: 1,
+		boss:        &bossRule{kind: bossAnthem, minEach: min(maxStars, rulesAct(actIndex)+2)},
+	}
+}
+
+// newAnthemBoss picks one of the hardest, longest songs in the act.
+func newAnthemBoss(actIndex int, songs []song, rng *mulberry32) *challenge {
+	if len(songs) == 0 {
+		return nil
+	}
+	ranked := append([]song{}, songs...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		di, dj := clampDifficulty(ranked[i].difficulty), clampDifficulty(ranked[j].difficulty)
+		if di != dj {
+			return di > dj
+		}
+		if ranked[i].seconds != ranked[j].seconds {
+			return ranked[i].seconds > ranked[j].seconds
+		}
+		return songKey(ranked[i]) < songKey(ranked[j])
+	})
+	ranked = ranked[:min(anthemCandidates, len(ranked))]
+	pick := ranked[rng.Intn(len(ranked))]
+
+	teaser := "A showpiece song waits at the top of the act."
+	if pick.seconds >= anthemMinimumEpic {
+		teaser = fmt.Sprintf("An epic of over %d minutes waits at the top of the act.", pick.seconds/60)
+	}
+	if decade := decadeForYear(pick.year); decade != 0 {
+		teaser += fmt.Sprintf(" Rumoured to be from the %ds.", decade)
+	}
+	return &challenge{
+		id:          "boss-anthem",
+		kind:        challengeBoss,
+		name:        "The Anthem",
+		summary:     teaser,
+		songs:       []song{pick},
+		selectCount: 1,
+		boss:        &bossRule{kind: bossAnthem, minEach: min(maxStars, rulesAct(actIndex)+2)},
+	}
+}
+
+// newMedleyBoss plays several songs by one artist back to back.
+func newMedleyBoss(actIndex int, songs []song, rng *mulberry32) *challenge {
+	byArtist := make(map[string][]song)
+	for _, s := range songs {
+		if s.artist != "" {
+			byArtist[s.artist] = append(byArtist[s.artist], s)
+		}
+	}
+	var artists []string
+	for artist, list := range byArtist {
+		if len(list) >= bossSetLength {
+			artists = append(artists, artist)
+		}
+	}
+	if len(artists) == 0 {
+		return nil
+	}
+	sort.Strings(artists)
+	artist := artists[rng.Intn(len(artists))]
+	picked := sampleSongs(byArtist[artist], bossSetLength, rng)
+
+	teaser := fmt.Sprintf("A %d-song medley by a single artist.", len(picked))
+	if genre := picked[0].genre; genre != "" {
+		teaser = fmt.Sprintf("A %d-song %s medley by a single artist.", len(picked), genre)
+	}
+	return &challenge{
+		id:          "boss-medley",
+		kind:        challengeBoss,
+		name:        "The Medley",
+		summary:     teaser,
+		songs:       picked,
+		selectCount: len(picked),
+		boss:        &bossRule{kind: bossMedley, minEach: min(maxStars, rulesAct(actIndex)+1)},
+	}
+}
+
+// newSetlistBoss strings together unrelated songs with no breaks.
+func newSetlistBoss(actIndex int, songs []song, rng *mulberry32) *challenge {
+	if len(songs) < bossSetLength {
+		return nil
+	}
+	picked := sampleSongs(songs, bossSetLength, rng)
+	total := 0
+	for _, s := range picked {
+		total += s.seconds
+	}
+	teaser := fmt.Sprintf("Play %d songs back to back, no breaks.", len(picked))
+	if total > 0 {
+		teaser = fmt.Sprintf("Play %d songs back to back, about %d minutes with no breaks.", len(picked), (total+30)/60)
+	}
+	return &challenge{
+		id:          "boss-setlist",
+		kind:        challengeBoss,
+		name:        "The Setlist",
+		summary:     teaser,
+		songs:       picked,
+		selectCount: len(picked),
+		boss:        &bossRule{kind: bossSetlist, minTotal: len(picked) * (rulesAct(actIndex) + 2)},
+	}
+}
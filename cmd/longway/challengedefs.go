@@ -0,0 +1,515 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	challengesFile  = "challenges.json"
+	challengesUsage = "usage: longway challenges validate [file]\n       longway challenges stats [--seeds N] [--circle N] [--catalog file] [--challenges file]"
+	statsSeeds      = 500
+)
+
+// customChallenges holds the definitions loaded at startup for the TUI's
+// runs. They join the built-in creators by per-act weight; with none loaded,
+// generation matches the web client draw for draw.
+var customChallenges []challengeDef
+
+// defsFingerprint identifies a set of definitions so a save can tell whether
+// it is resumed with the ones its map was generated from. It is empty when
+// none are loaded.
+func defsFingerprint(defs []challengeDef) string {
+	if len(defs) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(defs)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// challengeDef is one designer-authored challenge from challenges.json.
+type challengeDef struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Summary string `json:"summary"`
+	// Filter is an expression such as `genre == "metal" && seconds > 300`.
+	Filter string `json:"filter"`
+	// GroupBy picks one value of a field by seed (e.g. one decade) and keeps
+	// only songs sharing it.
+	GroupBy string `json:"groupBy,omitempty"`
+	// Weights is the relative weight per act. A missing map means weight 1 in
+	// every act; a missing act in a present map means 0.
+	Weights map[int]float64 `json:"weights,omitempty"`
+	Goal    int             `json:"goal,omitempty"`
+
+	filter songFilter
+}
+
+type challengeDefFile struct {
+	Challenges []challengeDef `json:"challenges"`
+}
+
+func (d challengeDef) weight(actIndex int) float64 {
+	if d.Weights == nil {
+		return 1
+	}
+	return d.Weights[actIndex]
+}
+
+// loadChallengeDefs reads and validates a definitions file, reporting every
+// problem at once.
+func loadChallengeDefs(path string) ([]challengeDef, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file challengeDefFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if errs := compileChallengeDefs(file.Challenges); len(errs) > 0 {
+		return nil, fmt.Errorf("%s: %w", path, errors.Join(errs...))
+	}
+	return file.Challenges, nil
+}
+
+func compileChallengeDefs(defs []challengeDef) []error {
+	var errs []error
+	seen := make(map[string]bool)
+	for i := range defs {
+		d := &defs[i]
+		where := fmt.Sprintf("challenge %d", i+1)
+		if d.ID != "" {
+			where = fmt.Sprintf("challenge %q", d.ID)
+		}
+		fail := func(format string, args ...any) {
+			errs = append(errs, fmt.Errorf("%s: "+format, append([]any{where}, args...)...))
+		}
+
+		switch {
+		case d.ID == "":
+			fail("id is empty")
+		case seen[d.ID]:
+			fail("duplicate id")
+		}
+		seen[d.ID] = true
+		if d.Name == "" {
+			fail("name is empty")
+		}
+		if d.Summary == "" {
+			fail("summary is empty")
+		}
+		for _, tmpl := range []string{d.Name, d.Summary} {
+			if err := checkTemplate(tmpl); err != nil {
+				fail("%v", err)
+			}
+		}
+		filter, err := parseSongFilter(d.Filter)
+		if err != nil {
+			fail("filter: %v", err)
+		}
+		d.filter = filter
+		if d.GroupBy != "" {
+			if _, ok := songFields[d.GroupBy]; !ok || d.GroupBy == "parts" {
+				fail("cannot group by %q", d.GroupBy)
+			}
+		}
+		for act, w := range d.Weights {
+			if act < 1 || act > maxRunActs {
+				fail("weight for unknown act %d", act)
+			}
+			if w < 0 {
+				fail("weight for act %d is negative", act)
+			}
+		}
+		if d.Goal < 0 || d.Goal > maxStars {
+			fail("goal %d is outside 0-%d", d.Goal, maxStars)
+		}
+	}
+	return errs
+}
+
+// create builds the challenge from the act catalog, or reports that too few
+// songs match.
+func (d challengeDef) create(actIndex int, songs []song, rng *mulberry32, poolSize, selectCount int) (*challenge, bool) {
+	need := max(3, selectCount)
+	var pool []song
+	for _, s := range songs {
+		if d.filter == nil || d.filter(s) {
+			pool = append(pool, s)
+		}
+	}
+
+	group := ""
+	if d.GroupBy != "" {
+		field := songFields[d.GroupBy]
+		order, groups := groupSongs(pool, func(s song) string { return strings.ToLower(field.text(s)) })
+		var eligible []string
+		for _, k := range order {
+			if len(groups[k]) >= need {
+				eligible = append(eligible, k)
+			}
+		}
+		if len(eligible) == 0 {
+			return nil, false
+		}
+		key := eligible[rng.Intn(len(eligible))]
+		pool = groups[key]
+		group = field.text(pool[0])
+	}
+	if len(pool) < need {
+		return nil, false
+	}
+
+	selected := sampleSongs(pool, poolSampleSize(poolSize, selectCount, len(pool)), rng)
+	pick := clampSelectCount(selectCount, len(selected))
+	goal := d.Goal
+	if goal == 0 {
+		goal = actGoal(actIndex)
+	}
+	vars := map[string]string{
+		"pick":  strconv.Itoa(pick),
+		"pool":  strconv.Itoa(len(selected)),
+		"group": group,
+		"act":   strconv.Itoa(actIndex),
+		"goal":  strconv.Itoa(goal),
+	}
+	for name, field := range songFields {
+		if name != "parts" {
+			vars[name] = field.text(selected[0])
+		}
+	}
+	return &challenge{
+		id:          "custom-" + d.ID,
+		name:        renderTemplate(d.Name, vars),
+		summary:     renderTemplate(d.Summary, vars),
+		songs:       selected,
+		selectCount: pick,
+		goal:        goal,
+	}, true
+}
+
+// pickCustomChallenge runs before the built-in creators when definitions are
+// loaded: the built-ins together weigh the sum of the act's challengeWeights,
+// and a custom definition wins the roll in proportion to its weight for the
+// act.
+func pickCustomChallenge(defs []challengeDef, actIndex int, builtins float64, songs []song, rng *mulberry32, poolSize, selectCount int) (*challenge, bool) {
+	var active []challengeDef
+	total := 0.0
+	for _, d := range defs {
+		if w := d.weight(actIndex); w > 0 {
+			active = append(active, d)
+			total += w
+		}
+	}
+	if len(active) == 0 {
+		return nil, false
+	}
+
+	roll := rng.Float64() * (total + builtins)
+	for _, d := range active {
+		roll -= d.weight(actIndex)
+		if roll < 0 {
+			return d.create(actIndex, songs, rng, poolSize, selectCount)
+		}
+	}
+	return nil, false
+}
+
+var templateVar = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+func templateVars() map[string]bool {
+	vars := map[string]bool{"pick": true, "pool": true, "group": true, "act": true, "goal": true}
+	for name := range songFields {
+		if name != "parts" {
+			vars[name] = true
+		}
+	}
+	return vars
+}
+
+func checkTemplate(tmpl string) error {
+	known := templateVars()
+	for _, m := range templateVar.FindAllStringSubmatch(tmpl, -1) {
+		if !known[m[1]] {
+			return fmt.Errorf("unknown placeholder {%s}", m[1])
+		}
+	}
+	return nil
+}
+
+func renderTemplate(tmpl string, vars map[string]string) string {
+	return templateVar.ReplaceAllStringFunc(tmpl, func(m string) string {
+		return vars[m[1:len(m)-1]]
+	})
+}
+
+// songField exposes a song attribute to filters, grouping and templates.
+type songField struct {
+	numeric bool
+	text    func(song) string
+	number  func(song) int
+}
+
+var songFields = map[string]songField{
+	"title":       textField(func(s song) string { return s.title }),
+	"artist":      textField(func(s song) string { return s.artist }),
+	"album":       textField(func(s song) string { return s.album }),
+	"genre":       textField(func(s song) string { return s.genre }),
+	"origin":      textField(func(s song) string { return s.origin }),
+	"series":      textField(func(s song) string { return s.series }),
+	"year":        numberField(func(s song) int { return s.year }),
+	"decade":      numberField(func(s song) int { return decadeForYear(s.year) }),
+	"seconds":     numberField(func(s song) int { return s.seconds }),
+	"difficulty":  numberField(func(s song) int { return clampDifficulty(s.difficulty) }),
+	"album_track": numberField(func(s song) int { return s.albumTrack }),
+	"parts":       textField(func(s song) string { return strings.Join(songParts(s), " ") }),
+}
+
+func textField(get func(song) string) songField {
+	return songField{text: get}
+}
+
+func numberField(get func(song) int) songField {
+	return songField{
+		numeric: true,
+		number:  get,
+		text:    func(s song) string { return strconv.Itoa(get(s)) },
+	}
+}
+
+func songParts(s song) []string {
+	var parts []string
+	if s.supportsGuitar {
+		parts = append(parts, "guitar")
+	}
+	if s.supportsBass {
+		parts = append(parts, "bass")
+	}
+	if s.supportsDrums {
+		parts = append(parts, "drums")
+	}
+	if s.supportsVocals {
+		parts = append(parts, "vocals")
+	}
+	return parts
+}
+
+type songFilter func(song) bool
+
+var filterClause = regexp.MustCompile(`^\s*([a-z_]+)\s*(==|!=|<=|>=|<|>|~|has)\s*("(?:[^"\\]|\\.)*"|-?\d+|[a-z]+)\s*$`)
+
+// parseSongFilter compiles `clause && clause || clause`, where && binds
+// tighter than || and each clause is `field op value`. Text fields compare
+// case-insensitively and support ~ (contains); `parts has drums` checks
+// instrument support. An empty filter matches every song.
+func parseSongFilter(expr string) (songFilter, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+	branches, err := splitOutsideQuotes(expr, "||")
+	if err != nil {
+		return nil, err
+	}
+	var anyOf [][]songFilter
+	for _, branch := range branches {
+		clauses, err := splitOutsideQuotes(branch, "&&")
+		if err != nil {
+			return nil, err
+		}
+		var allOf []songFilter
+		for _, clause := range clauses {
+			f, err := parseClause(clause)
+			if err != nil {
+				return nil, err
+			}
+			allOf = append(allOf, f)
+		}
+		anyOf = append(anyOf, allOf)
+	}
+	return func(s song) bool {
+		for _, allOf := range anyOf {
+			ok := true
+			for _, f := range allOf {
+				if !f(s) {
+					ok = false
+					break
+				}
+			}
+			if ok {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// splitOutsideQuotes splits expr on sep, ignoring separators inside quoted
+// values, so `title ~ "rock && roll"` stays one clause.
+func splitOutsideQuotes(expr, sep string) ([]string, error) {
+	var parts []string
+	start, quoted := 0, false
+	for i := 0; i < len(expr); i++ {
+		switch {
+		case quoted && expr[i] == '\\':
+			i++
+		case expr[i] == '"':
+			quoted = !quoted
+		case !quoted && strings.HasPrefix(expr[i:], sep):
+			parts = append(parts, expr[start:i])
+			i += len(sep) - 1
+			start = i + 1
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated string in %q", strings.TrimSpace(expr))
+	}
+	return append(parts, expr[start:]), nil
+}
+
+func parseClause(clause string) (songFilter, error) {
+	if strings.TrimSpace(clause) == "" {
+		return nil, errors.New("empty clause next to && or ||")
+	}
+	m := filterClause.FindStringSubmatch(clause)
+	if m == nil {
+		return nil, fmt.Errorf("cannot parse %q", strings.TrimSpace(clause))
+	}
+	name, op, raw := m[1], m[2], m[3]
+	field, ok := songFields[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q", name)
+	}
+	value := raw
+	if strings.HasPrefix(raw, `"`) {
+		unquoted, err := strconv.Unquote(raw)
+		if err != nil {
+			return nil, fmt.Errorf("bad string %s", raw)
+		}
+		if strings.TrimSpace(unquoted) != unquoted {
+			return nil, fmt.Errorf("string %s has leading or trailing spaces", raw)
+		}
+		value = unquoted
+	}
+
+	if name == "parts" {
+		if op != "has" {
+			return nil, fmt.Errorf("parts only supports has")
+		}
+		part := strings.ToLower(value)
+		return func(s song) bool {
+			for _, p := range songParts(s) {
+				if p == part {
+					return true
+				}
+			}
+			return false
+		}, nil
+	}
+
+	if field.numeric {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s needs a number, got %s", name, raw)
+		}
+		cmp := map[string]func(a int) bool{
+			"==": func(a int) bool { return a == n },
+			"!=": func(a int) bool { return a != n },
+			"<":  func(a int) bool { return a < n },
+			"<=": func(a int) bool { return a <= n },
+			">":  func(a int) bool { return a > n },
+			">=": func(a int) bool { return a >= n },
+		}[op]
+		if cmp == nil {
+			return nil, fmt.Errorf("%s does not support %s", name, op)
+		}
+		return func(s song) bool { return cmp(field.number(s)) }, nil
+	}
+
+	want := strings.ToLower(value)
+	switch op {
+	case "==":
+		return func(s song) bool { return strings.ToLower(field.text(s)) == want }, nil
+	case "!=":
+		return func(s song) bool { return strings.ToLower(field.text(s)) != want }, nil
+	case "~":
+		return func(s song) bool { return strings.Contains(strings.ToLower(field.text(s)), want) }, nil
+	}
+	return nil, fmt.Errorf("%s does not support %s", name, op)
+}
+
+// runChallengesCommand handles `longway challenges validate [path]` and
+// `longway challenges stats`, and returns the process exit code.
+func runChallengesCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) > 0 && args[0] == "stats" {
+		return runChallengeStats(args[1:], stdout, stderr)
+	}
+	if len(args) == 0 || args[0] != "validate" {
+		fmt.Fprintln(stderr, challengesUsage)
+		return 2
+	}
+	path := challengesFile
+	if len(args) > 1 {
+		path = args[1]
+	}
+	defs, err := loadChallengeDefs(path)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	ids := make([]string, len(defs))
+	for i, d := range defs {
+		ids[i] = d.ID
+	}
+	sort.Strings(ids)
+	fmt.Fprintf(stdout, "%s: %d challenges OK (%s)\n", path, len(defs), strings.Join(ids, ", "))
+	return 0
+}
+
+// runChallengeStats generates many seeds and prints the challenge mix per act,
+// so weight changes can be checked before anyone plays them.
+func runChallengeStats(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("challenges stats", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	seeds := fs.Int("seeds", statsSeeds, "number of seeds to generate (1..N)")
+	circle := fs.Int("circle", minCircle, "circle of hell to generate for")
+	catalog := fs.String("catalog", songsFile, "song catalog to load (.json or .csv)")
+	defsPath := fs.String("challenges", "", "custom challenge definitions to include")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *seeds < 1 || fs.NArg() > 0 {
+		fmt.Fprintln(stderr, challengesUsage)
+		return 2
+	}
+
+	songs, err := loadSongs(*catalog)
+	if err != nil {
+		fmt.Fprintln(stderr, "could not load songs:", err)
+		return 1
+	}
+	var defs []challengeDef
+	if *defsPath != "" {
+		if defs, err = loadChallengeDefs(*defsPath); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	}
+
+	writeChallengeDistribution(stdout, challengeDistribution(songs, clampCircle(*circle), *seeds, defs), *seeds, defs)
+	return 0
+}
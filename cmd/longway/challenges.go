@@ -2,16 +2,24 @@ package main
 
 import (
 	"fmt"
-	"math/rand"
+	"io"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
 
 type challenge struct {
-	id      string
-	name    string
-	summary string
-	songs   []song
+	id          string
+	kind        challengeType
+	name        string
+	summary     string
+	songs       []song
+	selectCount int
+	goal        int  // average stars needed to pass; 0 means no goal
+	ordered     bool // songs are played as listed, with no selection
+	boss        *bossRule
+	elite       *eliteRule
 }
 
 type challengeType int
@@ -22,30 +30,172 @@ const (
 	challengeLongSong
 	challengeGenre
 	challengeDifficulty
+	challengeShortSong
+	challengeMediumSong
+	challengeEpicSong
+	challengeArtist
+	challengeAlbum
+	challengeFullAlbum
+	challengeCompound
+	challengeCustom
+	challengeBoss
 )
 
-func newChallenge(songs []song, rng *rand.Rand, poolSize int) *challenge {
-	creators := []func([]song, *rand.Rand, int) (*challenge, bool){
-		newDecadeChallenge,
-		newLongSongChallenge,
-		newGenreChallenge,
-		newDifficultyChallenge,
+var challengeTypeNames = map[challengeType]string{
+	challengeTest:       "test",
+	challengeDecade:     "decade",
+	challengeLongSong:   "long",
+	challengeGenre:      "genre",
+	challengeDifficulty: "difficulty",
+	challengeShortSong:  "short",
+	challengeMediumSong: "medium",
+	challengeEpicSong:   "epic",
+	challengeArtist:     "artist",
+	challengeAlbum:      "album",
+	challengeFullAlbum:  "full-album",
+	challengeCompound:   "compound",
+	challengeCustom:     "custom",
+	challengeBoss:       "boss",
+}
+
+func (t challengeType) String() string {
+	return challengeTypeNames[t]
+}
+
+type challengeCreator func([]song, *mulberry32, int, int) (*challenge, bool)
+
+// challengeCreators is the order the creators are weighed in; the web
+// generator lists them the same way.
+var challengeCreators = []challengeType{
+	challengeShortSong,
+	challengeMediumSong,
+	challengeEpicSong,
+	challengeLongSong,
+	challengeDecade,
+	challengeDifficulty,
+	challengeGenre,
+	challengeArtist,
+	challengeAlbum,
+	challengeFullAlbum,
+	challengeCompound,
+}
+
+// challengeWeights sets how often each type is tried first in an act. Broad,
+// forgiving filters fade out as the run goes on while long songs, whole albums
+// and stacked predicates take over. A zero weight keeps a type out of the act.
+var challengeWeights = map[int]map[challengeType]int{
+	1: {
+		challengeShortSong: 3, challengeMediumSong: 3, challengeEpicSong: 1, challengeLongSong: 1,
+		challengeDecade: 3, challengeDifficulty: 2, challengeGenre: 3,
+		challengeArtist: 1, challengeAlbum: 1, challengeFullAlbum: 1, challengeCompound: 0,
+	},
+	2: {
+		challengeShortSong: 2, challengeMediumSong: 2, challengeEpicSong: 2, challengeLongSong: 2,
+		challengeDecade: 2, challengeDifficulty: 2, challengeGenre: 2,
+		challengeArtist: 2, challengeAlbum: 2, challengeFullAlbum: 2, challengeCompound: 3,
+	},
+	3: {
+		challengeShortSong: 1, challengeMediumSong: 1, challengeEpicSong: 3, challengeLongSong: 3,
+		challengeDecade: 1, challengeDifficulty: 2, challengeGenre: 1,
+		challengeArtist: 2, challengeAlbum: 2, challengeFullAlbum: 3, challengeCompound: 4,
+	},
+}
+
+// creatorWeights returns the act's weights in challengeCreators order; acts
+// past the table reuse the last act's weights.
+func creatorWeights(actIndex int) []int {
+	table, ok := challengeWeights[actIndex]
+	if !ok {
+		table = challengeWeights[totalActs]
+	}
+	weights := make([]int, len(challengeCreators))
+	for i, kind := range challengeCreators {
+		weights[i] = table[kind]
 	}
+	return weights
+}
+
+func creatorFor(kind challengeType, actIndex int) challengeCreator {
+	switch kind {
+	case challengeShortSong:
+		return newShortSongChallenge
+	case challengeMediumSong:
+		return newMediumSongChallenge
+	case challengeEpicSong:
+		return newEpicSongChallenge
+	case challengeLongSong:
+		return newLongSongChallenge
+	case challengeDecade:
+		return newDecadeChallenge
+	case challengeDifficulty:
+		return newDifficultyChallenge
+	case challengeGenre:
+		return newGenreChallenge
+	case challengeArtist:
+		return newArtistChallenge
+	case challengeAlbum:
+		return newAlbumChallenge
+	case challengeFullAlbum:
+		return newFullAlbumChallenge
+	case challengeCompound:
+		return func(songs []song, rng *mulberry32, poolSize, selectCount int) (*challenge, bool) {
+			return newCompoundChallenge(songs, rng, poolSize, selectCount, actIndex)
+		}
+	}
+	return nil
+}
 
+// newChallenge tries creators in a seeded order weighted by the act (see
+// challengeWeights). The order and weights match the web generator so both
+// clients draw the same pools for a seed; custom definitions
+// (challengedefs.go) get a weighted roll first when loaded.
+func newChallenge(actIndex int, songs []song, rng *mulberry32, poolSize, selectCount int, defs []challengeDef) *challenge {
 	if rng == nil {
-		rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+		rng = newMulberry32(time.Now().UnixNano())
 	}
 
-	for _, idx := range rng.Perm(len(creators)) {
-		if c, ok := creators[idx](songs, rng, poolSize); ok {
+	weights := creatorWeights(actIndex)
+	total := 0
+	for _, w := range weights {
+		total += w
+	}
+	if c, ok := pickCustomChallenge(defs, actIndex, float64(total), songs, rng, poolSize, selectCount); ok {
+		c.kind = challengeCustom
+		return c
+	}
+
+	for _, idx := range rng.weightedOrder(weights) {
+		kind := challengeCreators[idx]
+		if c, ok := creatorFor(kind, actIndex)(songs, rng, poolSize, selectCount); ok {
+			c.kind = kind
+			c.goal = actGoal(actIndex)
 			return c
 		}
 	}
 
-	return newTestChallenge(songs, poolSize)
+	c := newTestChallenge(songs, rng, poolSize, selectCount)
+	c.goal = actGoal(actIndex)
+	return c
 }
 
-func newDecadeChallenge(songs []song, rng *rand.Rand, poolSize int) (*challenge, bool) {
+// newUnorderedChallenge draws a built-in challenge the player picks songs
+// from, skipping custom definitions and ordered setlists.
+func newUnorderedChallenge(actIndex int, songs []song, rng *mulberry32, poolSize, selectCount int) *challenge {
+	for _, idx := range rng.weightedOrder(creatorWeights(actIndex)) {
+		kind := challengeCreators[idx]
+		if c, ok := creatorFor(kind, actIndex)(songs, rng, poolSize, selectCount); ok && !c.ordered {
+			c.kind = kind
+			c.goal = actGoal(actIndex)
+			return c
+		}
+	}
+
+	c := newTestChallenge(songs, rng, poolSize, selectCount)
+	c.goal = actGoal(actIndex)
+	return c
+}
+
+func newDecadeChallenge(songs []song, rng *mulberry32, poolSize, selectCount int) (*challenge, bool) {
 	byDecade := make(map[int][]song)
 	for _, s := range songs {
 		dec := decadeForYear(s.year)
@@ -61,6 +211,7 @@ func newDecadeChallenge(songs []song, rng *rand.Rand, poolSize int) (*challenge,
 			eligible = append(eligible, dec)
 		}
 	}
+	sort.Ints(eligible)
 
 	if len(eligible) == 0 {
 		return nil, false
@@ -68,53 +219,103 @@ func newDecadeChallenge(songs []song, rng *rand.Rand, poolSize int) (*challenge,
 
 	decade := eligible[rng.Intn(len(eligible))]
 	pool := byDecade[decade]
-	selected := sampleSongs(pool, min(poolSize, len(pool)), rng)
+	selected := sampleSongs(pool, poolSampleSize(poolSize, selectCount, len(pool)), rng)
 
-	summary := fmt.Sprintf("Pick any 3 of these %d tracks from the %ds.", len(selected), decade)
+	pick := clampSelectCount(selectCount, len(selected))
 
 	return &challenge{
-		id:      fmt.Sprintf("decade-%d", decade),
-		name:    "DecadeChallenge",
-		summary: summary,
-		songs:   selected,
+		id:          fmt.Sprintf("decade-%d", decade),
+		name:        "DecadeChallenge",
+		summary:     pickSummary(pick, len(selected), fmt.Sprintf("from the %ds", decade)),
+		songs:       selected,
+		selectCount: pick,
 	}, true
 }
 
-func newLongSongChallenge(songs []song, rng *rand.Rand, poolSize int) (*challenge, bool) {
-	var longSongs []song
+func newLongSongChallenge(songs []song, rng *mulberry32, poolSize, selectCount int) (*challenge, bool) {
+	return newLengthChallenge(songs, rng, poolSize, selectCount, lengthBand{
+		id:    "long-song",
+		name:  "LongSongChallenge",
+		label: "over 5 minutes",
+		match: func(seconds int) bool { return seconds > 300 }, // strictly over 5 minutes
+	})
+}
+
+func newShortSongChallenge(songs []song, rng *mulberry32, poolSize, selectCount int) (*challenge, bool) {
+	return newLengthChallenge(songs, rng, poolSize, selectCount, lengthBand{
+		id:    "short-song",
+		name:  "ShortSongChallenge",
+		label: "of 2:30 or less",
+		match: func(seconds int) bool { return seconds > 0 && seconds <= 150 },
+	})
+}
+
+func newMediumSongChallenge(songs []song, rng *mulberry32, poolSize, selectCount int) (*challenge, bool) {
+	return newLengthChallenge(songs, rng, poolSize, selectCount, lengthBand{
+		id:    "medium-song",
+		name:  "MediumSongChallenge",
+		label: "from 2:31 to 4:59",
+		match: func(seconds int) bool { return seconds > 150 && seconds < 300 },
+	})
+}
+
+func newEpicSongChallenge(songs []song, rng *mulberry32, poolSize, selectCount int) (*challenge, bool) {
+	return newLengthChallenge(songs, rng, poolSize, selectCount, lengthBand{
+		id:    "epic-song",
+		name:  "EpicSongChallenge",
+		label: "of 7 minutes or more",
+		match: func(seconds int) bool { return seconds >= 420 },
+	})
+}
+
+type lengthBand struct {
+	id    string
+	name  string
+	label string
+	match func(seconds int) bool
+}
+
+func newLengthChallenge(songs []song, rng *mulberry32, poolSize, selectCount int, band lengthBand) (*challenge, bool) {
+	var pool []song
 	for _, s := range songs {
-		if s.seconds > 300 { // strictly over 5 minutes
-			longSongs = append(longSongs, s)
+		if band.match(s.seconds) {
+			pool = append(pool, s)
 		}
 	}
 
-	if len(longSongs) < 3 {
+	if len(pool) < 3 {
 		return nil, false
 	}
 
-	selected := sampleSongs(longSongs, min(poolSize, len(longSongs)), rng)
+	selected := sampleSongs(pool, poolSampleSize(poolSize, selectCount, len(pool)), rng)
 
+	pick := clampSelectCount(selectCount, len(selected))
 	return &challenge{
-		id:      "long-song",
-		name:    "LongSongChallenge",
-		summary: fmt.Sprintf("Pick any 3 of these %d long tracks (over 5 minutes).", len(selected)),
-		songs:   selected,
+		id:          band.id,
+		name:        band.name,
+		summary:     pickSummary(pick, len(selected), band.label),
+		songs:       selected,
+		selectCount: pick,
 	}, true
 }
 
-func newGenreChallenge(songs []song, rng *rand.Rand, poolSize int) (*challenge, bool) {
+func newGenreChallenge(songs []song, rng *mulberry32, poolSize, selectCount int) (*challenge, bool) {
 	byGenre := make(map[string][]song)
+	var order []string // first-seen order, like JS object keys
 	for _, s := range songs {
 		if s.genre == "" {
 			continue
 		}
 		key := strings.ToLower(s.genre)
+		if _, ok := byGenre[key]; !ok {
+			order = append(order, key)
+		}
 		byGenre[key] = append(byGenre[key], s)
 	}
 
 	var eligible []string
-	for g, list := range byGenre {
-		if len(list) >= 3 {
+	for _, g := range order {
+		if len(byGenre[g]) >= 3 {
 			eligible = append(eligible, g)
 		}
 	}
@@ -125,18 +326,20 @@ func newGenreChallenge(songs []song, rng *rand.Rand, poolSize int) (*challenge,
 
 	genreKey := eligible[rng.Intn(len(eligible))]
 	pool := byGenre[genreKey]
-	selected := sampleSongs(pool, min(poolSize, len(pool)), rng)
+	selected := sampleSongs(pool, poolSampleSize(poolSize, selectCount, len(pool)), rng)
 
 	label := strings.Title(genreKey)
+	pick := clampSelectCount(selectCount, len(selected))
 	return &challenge{
-		id:      fmt.Sprintf("genre-%s", genreKey),
-		name:    "GenreChallenge",
-		summary: fmt.Sprintf("Pick any 3 of these %d %s tracks.", len(selected), label),
-		songs:   selected,
+		id:          fmt.Sprintf("genre-%s", genreKey),
+		name:        "GenreChallenge",
+		summary:     pickSummary(pick, len(selected), "in "+label),
+		songs:       selected,
+		selectCount: pick,
 	}, true
 }
 
-func newDifficultyChallenge(songs []song, rng *rand.Rand, poolSize int) (*challenge, bool) {
+func newDifficultyChallenge(songs []song, rng *mulberry32, poolSize, selectCount int) (*challenge, bool) {
 	if len(songs) == 0 {
 		return nil, false
 	}
@@ -153,6 +356,7 @@ func newDifficultyChallenge(songs []song, rng *rand.Rand, poolSize int) (*challe
 			eligible = append(eligible, level)
 		}
 	}
+	sort.Ints(eligible)
 
 	if len(eligible) == 0 {
 		return nil, false
@@ -160,74 +364,198 @@ func newDifficultyChallenge(songs []song, rng *rand.Rand, poolSize int) (*challe
 
 	level := eligible[rng.Intn(len(eligible))]
 	pool := buckets[level]
-	selected := sampleSongs(pool, min(poolSize, len(pool)), rng)
+	selected := sampleSongs(pool, poolSampleSize(poolSize, selectCount, len(pool)), rng)
 
+	pick := clampSelectCount(selectCount, len(selected))
 	return &challenge{
-		id:      fmt.Sprintf("difficulty-%d", level),
-		name:    "DifficultyChallenge",
-		summary: fmt.Sprintf("Pick any 3 of these %d tracks at difficulty %d.", len(selected), level),
-		songs:   selected,
+		id:          fmt.Sprintf("difficulty-%d", level),
+		name:        "DifficultyChallenge",
+		summary:     pickSummary(pick, len(selected), fmt.Sprintf("at difficulty %d", level)),
+		songs:       selected,
+		selectCount: pick,
 	}, true
 }
 
-func newTestChallenge(songs []song, poolSize int) *challenge {
-	candidates := songs
-	if len(candidates) == 0 {
-		candidates = []song{fallbackSong()}
+// groupSongs buckets songs by key in first-seen order (the web generator uses
+// a Map for the same ordering). Songs with an empty key are skipped.
+func groupSongs(songs []song, key func(song) string) ([]string, map[string][]song) {
+	var order []string
+	groups := make(map[string][]song)
+	for _, s := range songs {
+		k := key(s)
+		if k == "" {
+			continue
+		}
+		if _, ok := groups[k]; !ok {
+			order = append(order, k)
+		}
+		groups[k] = append(groups[k], s)
 	}
+	return order, groups
+}
 
-	s := fallbackSong()
-	if found, ok := findSongByTitle(candidates, "Eye of the Tiger"); ok {
-		s = found
-	} else {
-		s = candidates[0]
+func eligibleGroups(order []string, groups map[string][]song) []string {
+	var eligible []string
+	for _, k := range order {
+		if len(groups[k]) >= 3 {
+			eligible = append(eligible, k)
+		}
 	}
+	return eligible
+}
 
-	summary := "Play \"Eye of the Tiger\" to push through this encounter."
-	if s.artist != "" && s.title != "" {
-		summary = fmt.Sprintf("Play \"%s\" by %s to push through this encounter.", s.title, s.artist)
+func albumKey(s song) string {
+	if s.album == "" || s.artist == "" {
+		return ""
 	}
+	return s.artist + " — " + s.album
+}
 
+func newArtistChallenge(songs []song, rng *mulberry32, poolSize, selectCount int) (*challenge, bool) {
+	order, byArtist := groupSongs(songs, func(s song) string { return s.artist })
+	eligible := eligibleGroups(order, byArtist)
+	if len(eligible) == 0 {
+		return nil, false
+	}
+
+	artist := eligible[rng.Intn(len(eligible))]
+	pool := byArtist[artist]
+	selected := sampleSongs(pool, poolSampleSize(poolSize, selectCount, len(pool)), rng)
+
+	pick := clampSelectCount(selectCount, len(selected))
 	return &challenge{
-		id:      "test-challenge",
-		name:    "TestChallenge",
-		summary: summary,
-		songs:   sampleSongs(candidates, min(poolSize, len(candidates)), rand.New(rand.NewSource(time.Now().UnixNano()))),
+		id:          "artist-" + artist,
+		name:        "ArtistChallenge",
+		summary:     pickSummary(pick, len(selected), "by "+artist),
+		songs:       selected,
+		selectCount: pick,
+	}, true
+}
+
+func newAlbumChallenge(songs []song, rng *mulberry32, poolSize, selectCount int) (*challenge, bool) {
+	order, byAlbum := groupSongs(songs, albumKey)
+	eligible := eligibleGroups(order, byAlbum)
+	if len(eligible) == 0 {
+		return nil, false
 	}
+
+	key := eligible[rng.Intn(len(eligible))]
+	pool := byAlbum[key]
+	selected := sampleSongs(pool, poolSampleSize(poolSize, selectCount, len(pool)), rng)
+
+	pick := clampSelectCount(selectCount, len(selected))
+	return &challenge{
+		id:          "album-" + key,
+		name:        "AlbumChallenge",
+		summary:     pickSummary(pick, len(selected), fmt.Sprintf("from %s by %s", pool[0].album, pool[0].artist)),
+		songs:       selected,
+		selectCount: pick,
+	}, true
 }
 
-func bossChallenge(songs []song) *challenge {
-	pool := songs
-	if len(pool) == 0 {
-		pool = []song{fallbackSong()}
+// newFullAlbumChallenge asks for a consecutive run of an album's tracks,
+// played in album_track order.
+func newFullAlbumChallenge(songs []song, rng *mulberry32, poolSize, selectCount int) (*challenge, bool) {
+	order, byAlbum := groupSongs(songs, func(s song) string {
+		if s.albumTrack <= 0 {
+			return ""
+		}
+		return albumKey(s)
+	})
+	eligible := eligibleGroups(order, byAlbum)
+	if len(eligible) == 0 {
+		return nil, false
 	}
-	var boss song
-	if found, ok := findSongByTitle(pool, "Bohemian Rhapsody"); ok {
-		boss = found
-	} else {
-		boss = fallbackSong()
+
+	key := eligible[rng.Intn(len(eligible))]
+	tracks := append([]song{}, byAlbum[key]...)
+	sort.SliceStable(tracks, func(i, j int) bool { return tracks[i].albumTrack < tracks[j].albumTrack })
+	size := min(len(tracks), max(3, poolSize))
+	start := rng.Intn(len(tracks) - size + 1)
+	run := tracks[start : start+size]
+
+	return &challenge{
+		id:          "full-album-" + key,
+		name:        "FullAlbumChallenge",
+		summary:     fmt.Sprintf("Play all %d of these tracks from %s by %s, in album order.", len(run), run[0].album, run[0].artist),
+		songs:       run,
+		selectCount: len(run),
+		ordered:     true,
+	}, true
+}
+
+func newTestChallenge(songs []song, rng *mulberry32, poolSize, selectCount int) *challenge {
+	candidates := songs
+	if len(candidates) == 0 {
+		candidates = []song{fallbackSong()}
 	}
+
+	selected := sampleSongs(candidates, max(selectCount, poolSize), rng)
+	pick := clampSelectCount(selectCount, len(selected))
 	return &challenge{
-		id:      "boss-bohemian",
-		name:    "BossChallenge",
-		summary: "Final showdown: play Bohemian Rhapsody.",
-		songs:   []song{boss},
+		id:          "test-challenge",
+		name:        "TestChallenge",
+		summary:     pickSummary(pick, len(selected), "to push through this encounter"),
+		songs:       selected,
+		selectCount: pick,
+	}
+}
+
+// actGoal is the average-star target for an act's challenges (see docs/acts.md).
+func actGoal(actIndex int) int {
+	return min(5, max(3, actIndex+2))
+}
+
+func averageStars(stars []int) float64 {
+	if len(stars) == 0 {
+		return 0
+	}
+	total := 0
+	for _, s := range stars {
+		total += clampDifficulty(s)
 	}
+	return float64(total) / float64(len(stars))
 }
 
-func sampleSongs(pool []song, count int, rng *rand.Rand) []song {
+// meetsGoal matches the web client: no goal or no results always passes.
+func meetsGoal(goal int, stars []int) bool {
+	if goal <= 0 || len(stars) == 0 {
+		return true
+	}
+	return averageStars(stars) >= float64(goal)
+}
+
+// pickSummary mirrors summaryForSongs in the web generator.
+func pickSummary(selectCount, poolSize int, detail string) string {
+	if detail != "" {
+		detail = " " + detail
+	}
+	return fmt.Sprintf("Pick %d of these %d tracks%s.", selectCount, poolSize, detail)
+}
+
+func sampleSongs(pool []song, count int, rng *mulberry32) []song {
 	if len(pool) <= count {
 		return append([]song{}, pool...)
 	}
 
 	out := make([]song, 0, count)
-	indices := rng.Perm(len(pool))
-	for i := 0; i < count; i++ {
-		out = append(out, pool[indices[i]])
+	for _, idx := range rng.pickDistinct(len(pool), count) {
+		out = append(out, pool[idx])
 	}
 	return out
 }
 
+// poolSampleSize never offers fewer songs than the challenge asks for.
+func poolSampleSize(poolSize, selectCount, available int) int {
+	return max(selectCount, min(poolSize, available))
+}
+
+// clampSelectCount fits a pick count to a pool, leaving at least one song
+// unpicked so there is always a choice to make.
+func clampSelectCount(count, available int) int {
+	return max(1, min(count, available-1))
+}
+
 func decadeForYear(year int) int {
 	if year == 0 {
 		return 0
@@ -244,3 +572,77 @@ func clampDifficulty(d int) int {
 	}
 	return d
 }
+
+// challengeTally counts how often each challenge type lands in an act.
+type challengeTally struct {
+	act    int
+	total  int
+	counts map[string]int
+}
+
+// challengeLabel names a challenge for distribution reports; custom
+// definitions are listed by id.
+func challengeLabel(c *challenge) string {
+	if c.kind == challengeCustom {
+		return c.id
+	}
+	return c.kind.String()
+}
+
+// challengeDistribution generates a run for each seed in 1..seeds, with defs
+// joining the built-in creators, and tallies the regular (non-boss)
+// challenges per act.
+func challengeDistribution(songs []song, circle, seeds int, defs []challengeDef) []challengeTally {
+	tallies := make([]challengeTally, totalActs)
+	for i := range tallies {
+		tallies[i] = challengeTally{act: i + 1, counts: make(map[string]int)}
+	}
+	for seed := 1; seed <= seeds; seed++ {
+		for i, a := range generateShapedRun(standardRun, int64(seed), songs, circle, defs) {
+			for _, row := range a.rows {
+				for _, n := range row {
+					if n.kind != nodeChallenge || n.challenge == nil {
+						continue
+					}
+					tallies[i].counts[challengeLabel(n.challenge)]++
+					tallies[i].total++
+				}
+			}
+		}
+	}
+	return tallies
+}
+
+// writeChallengeDistribution prints each act's mix, most common first, next
+// to the configured weight so fallbacks (types the catalog cannot fill) stand
+// out.
+func writeChallengeDistribution(w io.Writer, tallies []challengeTally, seeds int, defs []challengeDef) {
+	for _, t := range tallies {
+		fmt.Fprintf(w, "Act %d: %d challenges over %d seeds\n", t.act, t.total, seeds)
+		labels := make([]string, 0, len(t.counts))
+		for label := range t.counts {
+			labels = append(labels, label)
+		}
+		sort.Slice(labels, func(i, j int) bool {
+			if t.counts[labels[i]] != t.counts[labels[j]] {
+				return t.counts[labels[i]] > t.counts[labels[j]]
+			}
+			return labels[i] < labels[j]
+		})
+		weights := make(map[string]string)
+		for i, w := range creatorWeights(t.act) {
+			weights[challengeCreators[i].String()] = strconv.Itoa(w)
+		}
+		for _, d := range defs {
+			weights["custom-"+d.ID] = strconv.FormatFloat(d.weight(t.act), 'g', -1, 64)
+		}
+		for _, label := range labels {
+			weight, ok := weights[label]
+			if !ok {
+				weight = "-"
+			}
+			share := 100 * float64(t.counts[label]) / float64(max(1, t.total))
+			fmt.Fprintf(w, "  %-28s %6d  %5.1f%%  weight %s\n", label, t.counts[label], share, weight)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import "fmt"
+
+const (
+	minCircle = 1
+	maxCircle = 9
+)
+
+type intensityBand struct {
+	min int
+	max int
+}
+
+// circleIntensityBounds mirrors docs/circles-of-hell.md.
+var circleIntensityBounds = map[int]intensityBand{
+	1: {0, 0},
+	2: {0, 1},
+	3: {0, 2},
+	4: {0, 3},
+	5: {0, 4},
+	6: {0, 5},
+	7: {0, 6},
+	8: {3, 6},
+	9: {5, 6},
+}
+
+func clampCircle(circle int) int {
+	if circle < minCircle {
+		return minCircle
+	}
+	if circle > maxCircle {
+		return maxCircle
+	}
+	return circle
+}
+
+// applyCircleIntensityConstraints filters the catalog to the circle's
+// intensity band. If the band is empty it widens one step on each side until
+// something matches, so thin catalogs still produce a playable run.
+func applyCircleIntensityConstraints(circle int, songs []song) []song {
+	if len(songs) == 0 {
+		return songs
+	}
+
+	band := circleIntensityBounds[clampCircle(circle)]
+	for {
+		filtered := filterByIntensity(songs, band)
+		if len(filtered) > 0 {
+			return filtered
+		}
+		if band.min == 0 && band.max == 6 {
+			return songs
+		}
+		band.min = max(0, band.min-1)
+		band.max = min(6, band.max+1)
+	}
+}
+
+func filterByIntensity(songs []song, band intensityBand) []song {
+	filtered := make([]song, 0, len(songs))
+	for _, s := range songs {
+		d := clampDifficulty(s.difficulty)
+		if d >= band.min && d <= band.max {
+			filtered = append(filtered, s)
+		}
+	}
+	return filtered
+}
+
+func circleLabel(circle int) string {
+	band := circleIntensityBounds[clampCircle(circle)]
+	if band.min == band.max {
+		return fmt.Sprintf("intensity %d", band.min)
+	}
+	return fmt.Sprintf("intensity %d-%d", band.min, band.max)
+}
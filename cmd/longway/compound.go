@@ -0,0 +1,201 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// challengeFacet is one attribute a compound challenge can filter on. A song
+// may carry several values (e.g. every instrument part it supports).
+type challengeFacet struct {
+	id     string
+	values func(song) []string
+	// label returns the short form used in the name and the long form used
+	// in the summary; example is any song carrying the value.
+	label func(key string, example song) (string, string)
+}
+
+// compoundFacets is in the order names are composed ("80s Metal over 5
+// minutes"); the web generator lists the same facets in the same order.
+var compoundFacets = []challengeFacet{
+	{
+		id: "decade",
+		values: func(s song) []string {
+			if dec := decadeForYear(s.year); dec != 0 {
+				return []string{strconv.Itoa(dec)}
+			}
+			return nil
+		},
+		label: func(key string, _ song) (string, string) {
+			return key[len(key)-2:] + "s", "from the " + key + "s"
+		},
+	},
+	{
+		id: "genre",
+		values: func(s song) []string {
+			if s.genre == "" {
+				return nil
+			}
+			return []string{strings.ToLower(s.genre)}
+		},
+		label: func(_ string, example song) (string, string) {
+			return example.genre, "in " + example.genre
+		},
+	},
+	{
+		id: "tier",
+		values: func(s song) []string {
+			return []string{strconv.Itoa(clampDifficulty(s.difficulty))}
+		},
+		label: func(key string, _ song) (string, string) {
+			return "tier " + key, "at difficulty " + key
+		},
+	},
+	{
+		id: "part",
+		values: func(s song) []string {
+			var parts []string
+			for _, p := range []struct {
+				name string
+				ok   bool
+			}{
+				{"guitar", s.supportsGuitar},
+				{"bass", s.supportsBass},
+				{"drums", s.supportsDrums},
+				{"vocals", s.supportsVocals},
+			} {
+				if p.ok {
+					parts = append(parts, p.name)
+				}
+			}
+			return parts
+		},
+		label: func(key string, _ song) (string, string) {
+			return "with " + key, "with a " + key + " part"
+		},
+	},
+	{
+		id: "origin",
+		values: func(s song) []string {
+			if s.origin == "" {
+				return nil
+			}
+			return []string{s.origin}
+		},
+		label: func(key string, _ song) (string, string) {
+			return "from " + key, "from " + key
+		},
+	},
+	{
+		id: "length",
+		values: func(s song) []string {
+			switch {
+			case s.seconds <= 0:
+				return nil
+			case s.seconds <= 150:
+				return []string{"short"}
+			case s.seconds < 300:
+				return []string{"medium"}
+			case s.seconds > 300:
+				return []string{"long"}
+			}
+			return nil
+		},
+		label: func(key string, _ song) (string, string) {
+			switch key {
+			case "short":
+				return "under 2:30", "of 2:30 or less"
+			case "medium":
+				return "from 2:31 to 4:59", "from 2:31 to 4:59"
+			default:
+				return "over 5 minutes", "over 5 minutes"
+			}
+		},
+	},
+}
+
+type facetChoice struct {
+	facet   int
+	key     string
+	example song
+}
+
+// newCompoundChallenge stacks two predicates in act 2 and two or three in
+// act 3, drawn by seed, narrowing the pool after each one. A predicate is
+// only taken if enough songs survive it, so the final pool always covers the
+// selection count. Act 1 keeps to single-attribute challenges.
+func newCompoundChallenge(songs []song, rng *mulberry32, poolSize, selectCount int, actIndex int) (*challenge, bool) {
+	if actIndex < 2 {
+		return nil, false
+	}
+	want := 2
+	if actIndex >= 3 {
+		want += rng.Intn(2)
+	}
+	need := max(3, selectCount)
+
+	candidates := songs
+	var chosen []facetChoice
+	for _, fi := range rng.shuffleOrder(len(compoundFacets)) {
+		if len(chosen) == want {
+			break
+		}
+		facet := compoundFacets[fi]
+		var order []string
+		groups := make(map[string][]song)
+		for _, s := range candidates {
+			for _, v := range facet.values(s) {
+				if _, ok := groups[v]; !ok {
+					order = append(order, v)
+				}
+				groups[v] = append(groups[v], s)
+			}
+		}
+		var eligible []string
+		for _, v := range order {
+			if len(groups[v]) >= need {
+				eligible = append(eligible, v)
+			}
+		}
+		if len(eligible) == 0 {
+			continue
+		}
+		key := eligible[rng.Intn(len(eligible))]
+		candidates = groups[key]
+		chosen = append(chosen, facetChoice{facet: fi, key: key, example: candidates[0]})
+	}
+	if len(chosen) < 2 {
+		return nil, false
+	}
+
+	selected := sampleSongs(candidates, poolSampleSize(poolSize, selectCount, len(candidates)), rng)
+	pick := clampSelectCount(selectCount, len(selected))
+	name, detail, id := describeFacets(chosen)
+	return &challenge{
+		id:          "compound-" + id,
+		name:        name,
+		summary:     pickSummary(pick, len(selected), detail),
+		songs:       selected,
+		selectCount: pick,
+	}, true
+}
+
+func describeFacets(chosen []facetChoice) (name, detail, id string) {
+	var shorts, longs, ids []string
+	for fi, facet := range compoundFacets {
+		for _, c := range chosen {
+			if c.facet != fi {
+				continue
+			}
+			short, long := facet.label(c.key, c.example)
+			shorts = append(shorts, short)
+			longs = append(longs, long)
+			ids = append(ids, facet.id+"="+c.key)
+		}
+	}
+	name = strings.Join(shorts, " ")
+	if name != "" {
+		name = strings.ToUpper(name[:1]) + name[1:]
+	}
+	return name, strings.Join(longs, ", "), strings.Join(ids, ",")
+}
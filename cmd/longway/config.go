@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// runConfig shapes a run's map: how many acts, how tall and wide they are, how
+// many special nodes each act gets and how big challenge pools are. Loaded
+// from run.json and flags; see docs/run-config.md.
+type runConfig struct {
+	Acts           int `json:"acts"`
+	RowsPerAct     int `json:"rowsPerAct"`
+	MinNodesPerRow int `json:"minNodesPerRow"`
+	MaxNodesPerRow int `json:"maxNodesPerRow"`
+	ShopsPerAct    int `json:"shopsPerAct"`
+	// ElitesPerAct caps elites; the opening acts ramp up to it (one in Act 1,
+	// two in Act 2, ...).
+	ElitesPerAct int `json:"elitesPerAct"`
+	RestsPerAct  int `json:"restsPerAct"`
+	EventsPerAct int `json:"eventsPerAct"`
+	// PoolBounds lists pool sizes per act; later acts reuse the last entry.
+	PoolBounds []poolBounds `json:"poolBounds"`
+}
+
+type poolBounds struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+const (
+	runConfigFile = "run.json"
+	maxRunActs    = 9
+	maxActRows    = 20
+	maxRowWidth   = 6
+)
+
+// standardRun is the three-act shape the web client generates; only this
+// shape is seed-compatible with it (see docs/parity.md).
+var standardRun = runConfig{
+	Acts:           totalActs,
+	RowsPerAct:     rowsPerAct,
+	MinNodesPerRow: minNodesPerRow,
+	MaxNodesPerRow: maxNodesPerRow,
+	ShopsPerAct:    2,
+	ElitesPerAct:   2,
+	RestsPerAct:    1,
+	EventsPerAct:   2,
+	PoolBounds:     []poolBounds{{9, 12}, {6, 9}, {3, 5}},
+}
+
+// runPresets are named shapes for --preset: a quick single act for parties
+// and a long haul for weekends.
+var runPresets = map[string]runConfig{
+	"standard": standardRun,
+	"party": {
+		Acts:           1,
+		RowsPerAct:     5,
+		MinNodesPerRow: 2,
+		MaxNodesPerRow: 3,
+		ShopsPerAct:    1,
+		ElitesPerAct:   1,
+		RestsPerAct:    1,
+		EventsPerAct:   1,
+		PoolBounds:     []poolBounds{{6, 9}},
+	},
+	"marathon": {
+		Acts:           5,
+		RowsPerAct:     10,
+		MinNodesPerRow: 2,
+		MaxNodesPerRow: 4,
+		ShopsPerAct:    3,
+		ElitesPerAct:   3,
+		RestsPerAct:    2,
+		EventsPerAct:   3,
+		PoolBounds:     []poolBounds{{9, 12}, {8, 11}, {6, 9}, {4, 7}, {3, 5}},
+	},
+}
+
+// rulesAct is the act whose boss and elite thresholds a deeper act uses:
+// acts past the standard three play by Act 3's.
+func rulesAct(actIndex int) int {
+	return min(actIndex, totalActs)
+}
+
+// poolBoundsForAct is the pool size range for an act's challenges.
+func (c runConfig) poolBoundsForAct(actIndex int) (int, int) {
+	if len(c.PoolBounds) == 0 {
+		return standardRun.poolBoundsForAct(actIndex)
+	}
+	b := c.PoolBounds[min(max(actIndex, 1), len(c.PoolBounds))-1]
+	return b.Min, b.Max
+}
+
+func (c runConfig) validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	check(c.Acts >= 1 && c.Acts <= maxRunActs, "acts must be 1-%d, got %d", maxRunActs, c.Acts)
+	check(c.RowsPerAct >= 2 && c.RowsPerAct <= maxActRows, "rowsPerAct must be 2-%d, got %d", maxActRows, c.RowsPerAct)
+	check(c.MinNodesPerRow >= 1 && c.MinNodesPerRow <= c.MaxNodesPerRow && c.MaxNodesPerRow <= maxRowWidth,
+		"row width must satisfy 1 <= minNodesPerRow <= maxNodesPerRow <= %d, got %d-%d", maxRowWidth, c.MinNodesPerRow, c.MaxNodesPerRow)
+	check(c.ShopsPerAct >= 0 && c.ElitesPerAct >= 0 && c.RestsPerAct >= 0 && c.EventsPerAct >= 0,
+		"shop, elite, rest and event counts can't be negative")
+	for i, b := range c.PoolBounds {
+		check(b.Min >= 1 && b.Min <= b.Max, "poolBounds[%d] must satisfy 1 <= min <= max, got %d-%d", i, b.Min, b.Max)
+	}
+	return errors.Join(errs...)
+}
+
+func (c runConfig) isStandard() bool {
+	return reflect.DeepEqual(c, standardRun)
+}
+
+func (c runConfig) summary() string {
+	return fmt.Sprintf("%d act(s) × %d rows, %d-%d wide", c.Acts, c.RowsPerAct, c.MinNodesPerRow, c.MaxNodesPerRow)
+}
+
+// loadRunConfig reads a run shape. Fields missing from the file keep their
+// values from base, so a file can change just the act count.
+func loadRunConfig(path string, base runConfig) (runConfig, error) {
+	cfg := base
+	cfg.PoolBounds = append([]poolBounds{}, base.PoolBounds...)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// runConfigFlags registers the shape flags on fs. resolve applies them in
+// order: preset, then the config file, then any flag given explicitly.
+type runConfigFlags struct {
+	fs     *flag.FlagSet
+	preset *string
+	path   *string
+	acts   *int
+	rows   *int
+	minW   *int
+	maxW   *int
+	shops  *int
+	elites *int
+	rests  *int
+	events *int
+}
+
+func addRunConfigFlags(fs *flag.FlagSet) *runConfigFlags {
+	names := make([]string, 0, len(runPresets))
+	for name := range runPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return &runConfigFlags{
+		fs:     fs,
+		preset: fs.String("preset", "standard", "run shape preset: "+strings.Join(names, ", ")),
+		path:   fs.String("config", runConfigFile, "run shape file (skipped if the default file is missing)"),
+		acts:   fs.Int("acts", 0, "acts per run"),
+		rows:   fs.Int("rows", 0, "rows per act, boss row included"),
+		minW:   fs.Int("min-width", 0, "fewest nodes in a row"),
+		maxW:   fs.Int("max-width", 0, "most nodes in a row"),
+		shops:  fs.Int("shops", 0, "shop rows per act"),
+		elites: fs.Int("elites", 0, "most elites per act"),
+		rests:  fs.Int("rests", 0, "rests per act"),
+		events: fs.Int("events", 0, "\"?\" events per act"),
+	}
+}
+
+func (f *runConfigFlags) resolve() (runConfig, error) {
+	base, ok := runPresets[*f.preset]
+	if !ok {
+		return runConfig{}, fmt.Errorf("unknown preset %q", *f.preset)
+	}
+	cfg, err := loadRunConfig(*f.path, base)
+	switch {
+	case err == nil:
+	case os.IsNotExist(err) && *f.path == runConfigFile:
+		cfg = base
+	default:
+		return cfg, err
+	}
+	overrides := map[string]func(){
+		"acts":      func() { cfg.Acts = *f.acts },
+		"rows":      func() { cfg.RowsPerAct = *f.rows },
+		"min-width": func() { cfg.MinNodesPerRow = *f.minW },
+		"max-width": func() { cfg.MaxNodesPerRow = *f.maxW },
+		"shops":     func() { cfg.ShopsPerAct = *f.shops },
+		"elites":    func() { cfg.ElitesPerAct = *f.elites },
+		"rests":     func() { cfg.RestsPerAct = *f.rests },
+		"events":    func() { cfg.EventsPerAct = *f.events },
+	}
+	f.fs.Visit(func(fl *flag.Flag) {
+		if apply, ok := overrides[fl.Name]; ok {
+			apply()
+		}
+	})
+	return cfg, cfg.validate()
+}
@@ -0,0 +1,101 @@
+package main
+
+import "fmt"
+
+const (
+	eliteMinStars = 4
+	eliteBonus    = 40
+	eliteFirstRow = 2
+)
+
+// eliteRule is the extra condition an elite adds on top of its goal: every
+// song must reach minStars. floor is the difficulty tier the pool was drawn
+// from, or 0 when the act had too few hard songs.
+type eliteRule struct {
+	minStars int
+	floor    int
+}
+
+func (r eliteRule) met(stars []int) bool {
+	for _, s := range stars {
+		if s < r.minStars {
+			return false
+		}
+	}
+	return len(stars) > 0
+}
+
+// misses counts the songs under the star floor; each one costs voltage on
+// top of the goal shortfall.
+func (r eliteRule) misses(stars []int) int {
+	n := 0
+	for _, s := range stars {
+		if s < r.minStars {
+			n++
+		}
+	}
+	return n
+}
+
+func (r eliteRule) summary() string {
+	line := fmt.Sprintf("Elite: no song under %d★", r.minStars)
+	if r.floor > 0 {
+		line += fmt.Sprintf(", every song tier %d or harder", r.floor)
+	}
+	return line + "."
+}
+
+// elitesForAct is how many elites an act gets: one in the opener, one more
+// per act after that up to limit.
+func elitesForAct(actIndex, limit int) int {
+	return min(limit, actIndex)
+}
+
+func eliteDifficultyFloor(actIndex int) int {
+	return min(6, rulesAct(actIndex)+2)
+}
+
+// assignElites turns challenge nodes in mid-act rows into elites, at most one
+// per row. Shop rows, the opening row and the last two rows are skipped so
+// every act starts easy and the boss approach stays open. Elite songs are
+// marked used so no other node in the run offers them again.
+func assignElites(cfg runConfig, a *act, seed int64, songs []song, used map[string]bool, defs []challengeDef) {
+	var candidates []int
+	for r := eliteFirstRow; r < len(a.rows)-2; r++ {
+		if len(a.rows[r]) > 0 && a.rows[r][0].kind == nodeChallenge {
+			candidates = append(candidates, r)
+		}
+	}
+	if len(candidates) == 0 {
+		return
+	}
+	actSongs := applyActDifficultyConstraints(a.index, songs)
+	rng := newMulberry32(sideSeed(seed, a.index, eliteStream))
+	for _, idx := range rng.pickDistinct(len(candidates), elitesForAct(a.index, cfg.ElitesPerAct)) {
+		row := a.rows[candidates[idx]]
+		n := &row[rng.Intn(len(row))]
+		n.kind = nodeElite
+		n.challenge = newEliteChallenge(cfg, a.index, freshSongs(actSongs, used), rng, n.challenge.selectCount, defs)
+		markUsed(used, n.challenge.songs)
+	}
+}
+
+// newEliteChallenge draws a regular challenge from the act's hardest songs
+// and raises its goal by a star.
+func newEliteChallenge(cfg runConfig, actIndex int, songs []song, rng *mulberry32, selectCount int, defs []challengeDef) *challenge {
+	floor := eliteDifficultyFloor(actIndex)
+	var hard []song
+	for _, s := range songs {
+		if clampDifficulty(s.difficulty) >= floor {
+			hard = append(hard, s)
+		}
+	}
+	if len(hard) < max(3, selectCount) {
+		hard, floor = songs, 0
+	}
+	c := newChallenge(actIndex, hard, rng, pickPoolSize(cfg, actIndex, len(hard), rng), selectCount, defs)
+	c.name = "Elite " + c.name
+	c.goal = min(maxStars, actGoal(actIndex)+1)
+	c.elite = &eliteRule{minStars: eliteMinStars, floor: floor}
+	return c
+}
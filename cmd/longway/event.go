@@ -0,0 +1,277 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	brokenStringCap  = 3
+	labelDealVoltage = 2000
+)
+
+// eventChoice is one answer to an event. cost is cash the choice needs up
+// front; apply changes the run and returns the outcome shown afterwards.
+type eventChoice struct {
+	id      string
+	label   string
+	summary string
+	cost    int
+	apply   func(m *model) string
+}
+
+type randomEvent struct {
+	id      string
+	name    string
+	text    string
+	choices []eventChoice
+}
+
+// eventTable is what a "?" node can turn out to be. Events are drawn by seed,
+// so the same run always meets the same ones.
+var eventTable = []randomEvent{
+	{
+		id:   "broken-string",
+		name: "Broken String",
+		text: "A string snaps during soundcheck and the spares are in the other van.",
+		choices: []eventChoice{
+			{
+				id:      "play-on",
+				label:   "Play on",
+				summary: fmt.Sprintf("Your next pick must be difficulty %d or lower.", brokenStringCap),
+				apply: func(m *model) string {
+					m.difficultyCap = brokenStringCap
+					return fmt.Sprintf("You tune around it. Next challenge: songs at difficulty %d or lower.", brokenStringCap)
+				},
+			},
+			{
+				id:      "buy-strings",
+				label:   "Buy a fresh set",
+				summary: "Costs $30.",
+				cost:    30,
+				apply: func(m *model) string {
+					return "Fresh strings, no compromises."
+				},
+			},
+		},
+	},
+	{
+		id:   "groupie",
+		name: "Groupie",
+		text: "A fan has followed the tour for three cities and wants to help.",
+		choices: []eventChoice{
+			{
+				id:      "merch",
+				label:   "Let them sell merch",
+				summary: "Gain $20 per act.",
+				apply: func(m *model) string {
+					gain := 20 * m.acts[m.currentAct].index
+					m.currency += gain
+					return fmt.Sprintf("The merch table earns %s.", formatCurrency(gain))
+				},
+			},
+			{
+				id:      "setlist",
+				label:   "Ask for a lucky setlist",
+				summary: "Gain a reroll token.",
+				apply: func(m *model) string {
+					m.rerolls++
+					return "They hand you a setlist scrawled with alternatives. +1 reroll token."
+				},
+			},
+		},
+	},
+	{
+		id:   "label-deal",
+		name: "Label Deal",
+		text: "A label rep offers to fast-track you past the next gig, for a price.",
+		choices: []eventChoice{
+			{
+				id:      "sign",
+				label:   "Sign",
+				summary: fmt.Sprintf("Lose %s V and skip the next row.", formatVoltage(labelDealVoltage)),
+				apply: func(m *model) string {
+					m.voltage, m.lastLoss = drainVoltage(m.voltage, labelDealVoltage)
+					m.skipNextRow = true
+					return "The ink is dry. The next row goes by in a blur."
+				},
+			},
+			{
+				id:      "walk",
+				label:   "Walk away",
+				summary: "Nothing happens.",
+				apply: func(m *model) string {
+					return "You keep your independence."
+				},
+			},
+		},
+	},
+	{
+		id:   "roadie",
+		name: "Roadie Trouble",
+		text: "Your roadie threatens to quit unless the band pays for a proper rig.",
+		choices: []eventChoice{
+			{
+				id:      "pay",
+				label:   "Pay up",
+				summary: "Costs $40, restores 2,000 V.",
+				cost:    40,
+				apply: func(m *model) string {
+					m.voltage = min(startingVoltage, m.voltage+2000)
+					return "The new rig hums. +2,000 V."
+				},
+			},
+			{
+				id:      "diy",
+				label:   "Haul it yourself",
+				summary: "Lose 1,000 V.",
+				apply: func(m *model) string {
+					m.voltage, m.lastLoss = drainVoltage(m.voltage, 1000)
+					return "Your back disagrees with this decision. -1,000 V."
+				},
+			},
+		},
+	},
+}
+
+// choice looks up a recorded "event:choice" key.
+func (e *randomEvent) choice(key string) *eventChoice {
+	for i := range e.choices {
+		if e.id+":"+e.choices[i].id == key {
+			return &e.choices[i]
+		}
+	}
+	return nil
+}
+
+// assignEvents turns up to count challenge nodes into "?" events, at most one
+// per row. The last two rows are skipped so a label deal can never skip the
+// boss.
+func assignEvents(a *act, seed int64, count int) {
+	var candidates []int
+	for r := 1; r < len(a.rows)-2; r++ {
+		for _, n := range a.rows[r] {
+			if n.kind == nodeChallenge {
+				candidates = append(candidates, r)
+				break
+			}
+		}
+	}
+	rng := newMulberry32(sideSeed(seed, a.index, eventStream))
+	for _, idx := range rng.pickDistinct(len(candidates), count) {
+		row := a.rows[candidates[idx]]
+		var cols []int
+		for c, n := range row {
+			if n.kind == nodeChallenge {
+				cols = append(cols, c)
+			}
+		}
+		n := &row[cols[rng.Intn(len(cols))]]
+		n.kind = nodeUnknown
+		n.challenge = nil
+		n.event = &eventTable[rng.Intn(len(eventTable))]
+	}
+}
+
+func (m *model) openEvent() {
+	n := m.selectedNode()
+	if n == nil || n.kind != nodeUnknown || n.event == nil {
+		return
+	}
+	m.eventing = true
+	m.eventIdx = 0
+	m.eventMessage = ""
+}
+
+func (m *model) moveEventCursor(delta int) {
+	n := m.selectedNode()
+	if n == nil || n.event == nil {
+		return
+	}
+	m.eventIdx = max(0, min(len(n.event.choices)-1, m.eventIdx+delta))
+}
+
+// chooseEvent resolves the highlighted choice, records it in the row's run
+// and moves on (past the next row too, after a label deal).
+func (m *model) chooseEvent() {
+	n := m.selectedNode()
+	if !m.eventing || n == nil || n.event == nil || m.eventIdx < 0 || m.eventIdx >= len(n.event.choices) {
+		return
+	}
+	choice := n.event.choices[m.eventIdx]
+	if m.currency < choice.cost {
+		m.eventMessage = fmt.Sprintf("Not enough cash: %s needs %s.", choice.label, formatCurrency(choice.cost))
+		return
+	}
+	m.currency -= choice.cost
+	m.eventMessage = choice.apply(m)
+	m.runs[m.cursorRow] = nodeRun{col: m.cursorCol, event: n.event.id + ":" + choice.id}
+	m.eventing = false
+	if m.voltage == 0 {
+		m.gameOver = true
+	}
+	m.advanceRow()
+	if m.skipNextRow {
+		m.skipNextRow = false
+		m.skipRow()
+	}
+	m.autosave()
+}
+
+// skipRow passes through the first reachable node of the current row without
+// playing it, recording the skip in the run history.
+func (m *model) skipRow() {
+	if m.cursorRow >= len(m.acts[m.currentAct].rows)-1 {
+		return
+	}
+	m.committed[m.cursorRow] = m.cursorCol
+	m.runs[m.cursorRow] = nodeRun{col: m.cursorCol, skipped: true}
+	m.advanceRow()
+}
+
+// capBlocks reports whether a broken string rules out picking sel. The cap
+// is waived when the pool has nothing easy enough.
+func (m model) capBlocks(sel song) bool {
+	if m.difficultyCap == 0 || sel.difficulty <= m.difficultyCap {
+		return false
+	}
+	for _, s := range m.selectionPool {
+		if s.difficulty <= m.difficultyCap {
+			return true
+		}
+	}
+	return false
+}
+
+func renderEventPreview(n *node, m *model) string {
+	var b strings.Builder
+	if n.event == nil {
+		return "Unknown node."
+	}
+	if m == nil || !m.eventing {
+		if m != nil {
+			if run, ok := m.runs[m.cursorRow]; ok && run.col == m.cursorCol && run.event != "" {
+				if choice := n.event.choice(run.event); choice != nil {
+					b.WriteString(fmt.Sprintf("Event: %s\nYou chose: %s. %s", n.event.name, choice.label, choice.summary))
+					return b.String()
+				}
+			}
+		}
+		b.WriteString("Event: ???\nSomething happens on the road. Press enter to find out.")
+		return b.String()
+	}
+
+	b.WriteString(fmt.Sprintf("Event: %s\n%s\n\n", n.event.name, n.event.text))
+	for i, choice := range n.event.choices {
+		cursor := "  "
+		if i == m.eventIdx {
+			cursor = "> "
+		}
+		b.WriteString(fmt.Sprintf("%s%s — %s\n", cursor, choice.label, choice.summary))
+	}
+	if m.eventMessage != "" {
+		b.WriteString("\n" + m.eventMessage + "\n")
+	}
+	b.WriteString("\nControls: ↑/↓ (k/j) choose • enter decides")
+	return b.String()
+}
@@ -0,0 +1,111 @@
+package main
+
+import "strings"
+
+type instrument string
+
+// instruments mirrors the web client's instrument list (values are shared so
+// saves read the same in both clients), plus guitar co-op from the catalog.
+const (
+	instrumentBand   instrument = "band"
+	instrumentGuitar instrument = "guitar"
+	instrumentBass   instrument = "bass"
+	instrumentDrums  instrument = "drums"
+	instrumentVocals instrument = "vocals"
+	instrumentKeys   instrument = "keys"
+	instrumentRhythm instrument = "rhythm"
+	instrumentCoop   instrument = "coop"
+)
+
+var instruments = []instrument{
+	instrumentBand,
+	instrumentGuitar,
+	instrumentBass,
+	instrumentDrums,
+	instrumentVocals,
+	instrumentKeys,
+	instrumentRhythm,
+	instrumentCoop,
+}
+
+func (i instrument) label() string {
+	switch i {
+	case instrumentCoop:
+		return "Guitar Co-op"
+	case "":
+		return "Band"
+	default:
+		return strings.ToUpper(string(i[:1])) + string(i[1:])
+	}
+}
+
+func parseInstrument(val string) instrument {
+	for _, inst := range instruments {
+		if strings.EqualFold(val, string(inst)) {
+			return inst
+		}
+	}
+	return instrumentBand
+}
+
+// tier returns the song's difficulty for the instrument and whether the song
+// has that part at all (catalogs use -1 for a missing part).
+func (s song) tier(inst instrument) (int, bool) {
+	var d int
+	switch inst {
+	case instrumentGuitar:
+		d = s.diffGuitar
+	case instrumentBass:
+		d = s.diffBass
+	case instrumentDrums:
+		d = s.diffDrums
+	case instrumentVocals:
+		d = s.diffVocals
+	case instrumentKeys:
+		d = s.diffKeys
+	case instrumentRhythm:
+		d = s.diffRhythm
+	case instrumentCoop:
+		d = s.diffCoop
+	default:
+		return s.difficulty, true
+	}
+	if d < 0 {
+		return 0, false
+	}
+	return d, true
+}
+
+// songsForInstrument re-tiers the catalog for the chosen instrument: songs
+// without the part are dropped and difficulty becomes the part's tier, so
+// circle, act and challenge filters all gate on what the player will play.
+// If no song has the part the catalog is returned unchanged.
+func songsForInstrument(songs []song, inst instrument) []song {
+	if inst == instrumentBand || inst == "" {
+		return songs
+	}
+	out := make([]song, 0, len(songs))
+	for _, s := range songs {
+		d, ok := s.tier(inst)
+		if !ok {
+			continue
+		}
+		s.difficulty = d
+		out = append(out, s)
+	}
+	if len(out) == 0 {
+		return songs
+	}
+	return out
+}
+
+func cycleInstrument(current instrument, delta int) instrument {
+	idx := 0
+	for i, inst := range instruments {
+		if inst == current {
+			idx = i
+		}
+	}
+	idx = (idx + delta + len(instruments)) % len(instruments)
+	return instruments[idx]
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"strings"
@@ -11,26 +12,73 @@ import (
 )
 
 type model struct {
-	acts           []act
-	currentAct     int
-	cursorRow      int
-	cursorCol      int
-	songs          []song
-	allowed        []int
-	allowedIdx     int
-	committed      map[int]int
-	runs           map[int]nodeRun
-	selectingSongs bool
-	selectionPool  []song
-	selectionIdx   int
-	selectedSongs  []song
-	selectedStars  []int
-	enteringStars  bool
-	starEntryIdx   int
-	starInput      string
-	seed           int64
-	width          int
-	height         int
+	acts            []act
+	currentAct      int
+	cursorRow       int
+	cursorCol       int
+	songs           []song
+	allowed         []int
+	allowedIdx      int
+	committed       map[int]int     // choices for the act on screen
+	runs            map[int]nodeRun // results for the act on screen
+	actCommitted    []map[int]int   // every act's choices; committed aliases one
+	actRuns         []map[int]nodeRun
+	progressAct     int // furthest unlocked act; earlier acts are read-only
+	runComplete     bool
+	notice          string
+	selectingSongs  bool
+	selectionPool   []song
+	selectionIdx    int
+	selectedSongs   []song
+	selectedStars   []int
+	selectMessage   string
+	played          map[string]bool // song keys submitted anywhere in the run
+	enteringStars   bool
+	starEntryIdx    int
+	starInput       string
+	starUndo        []int // song indices entered so far, most recent last
+	confirmingStars bool
+	voltage         int
+	lastLoss        int
+	gameOver        bool
+	currency        int
+	rerolls         int
+	rerollCount     int
+	redraws         []savedRedraw // reroll draws, replayed on resume
+	extraSlots      int
+	purchased       map[string]bool
+	shopping        bool
+	shopItems       []shopItem
+	shopIdx         int
+	shopMessage     string
+	resting         bool
+	restIdx         int
+	eventing        bool
+	eventIdx        int
+	eventMessage    string
+	difficultyCap   int // broken string: highest difficulty for the next picks
+	skipNextRow     bool
+	circle          int
+	instrument      instrument
+	choosingCircle  bool
+	circleCursor    int
+	instrumentPick  instrument // instrument shown in the picker until enter applies it
+	savePath        string
+	saveErr         error
+	resumePrompt    bool
+	pendingSave     *savedRun
+	sources         map[string]sourceInfo
+	originGroups    []originGroup
+	originCounts    map[string]int
+	selectedOrigins map[string]bool
+	choosingOrigins bool
+	pendingOrigins  map[string]bool
+	originCursor    int
+	seed            int64
+	config          runConfig // shape of new runs; see config.go
+	runShape        runConfig // shape of the map being played
+	width           int
+	height          int
 }
 
 var (
@@ -39,25 +87,59 @@ var (
 				Foreground(lipgloss.Color("#1E1E2E")).
 				Background(lipgloss.Color("#F0D94A")).
 				Bold(true)
-	shopStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#94E2D5")).Bold(true)
+	shopStyle       = lipgloss.NewStyle().Foreground(lipgloss.Color("#94E2D5")).Bold(true)
+	voltageStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("#F9E2AF")).Bold(true)
+	lowVoltageStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#F38BA8")).Bold(true)
 )
 
-const songsFile = "downloaded_songs.csv"
+const (
+	songsFile      = "downloaded_songs.json"
+	sourceInfoFile = "source_info.csv"
+)
+
+// originPickerWindow caps how many origin rows are shown at once.
+const originPickerWindow = 16
 
 func newModel(songs []song) model {
+	return newShapedModel(songs, standardRun)
+}
+
+// newShapedModel builds a model whose opening map and later runs use cfg.
+func newShapedModel(songs []song, cfg runConfig) model {
 	seed := time.Now().UnixNano()
-	acts := generateRun(seed, songs)
-	return model{
-		acts:       acts,
-		currentAct: 0,
-		cursorRow:  0,
-		cursorCol:  0,
-		songs:      songs,
-		allowed:    initAllowed(acts[0]),
-		allowedIdx: 0,
-		committed:  make(map[int]int),
-		runs:       make(map[int]nodeRun),
-		seed:       seed,
+	acts := generateShapedRun(cfg, seed, songs, minCircle, customChallenges)
+	m := model{
+		acts:           acts,
+		currentAct:     0,
+		cursorRow:      0,
+		cursorCol:      0,
+		songs:          songs,
+		allowed:        initAllowed(acts[0]),
+		allowedIdx:     0,
+		voltage:        startingVoltage,
+		purchased:      make(map[string]bool),
+		played:         make(map[string]bool),
+		circle:         minCircle,
+		instrument:     instrumentBand,
+		choosingCircle: true,
+		circleCursor:   minCircle,
+		instrumentPick: instrumentBand,
+		seed:           seed,
+		config:         cfg,
+		runShape:       cfg,
+	}
+	m.resetProgress()
+	m.committed, m.runs = m.actState(0)
+	m.setSources(nil)
+	return m
+}
+
+func (m *model) setSources(sources map[string]sourceInfo) {
+	m.sources = sources
+	m.originGroups = collectOriginGroups(m.songs, sources)
+	m.originCounts = make(map[string]int)
+	for _, s := range m.songs {
+		m.originCounts[s.origin]++
 	}
 }
 
@@ -76,6 +158,107 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, tea.Quit
 		}
 
+		if m.resumePrompt {
+			switch msg.String() {
+			case "enter", "c":
+				m.resumeSaved()
+			case "n":
+				m.resumePrompt = false
+				m.pendingSave = nil
+				m.openCirclePicker()
+			}
+			return m, nil
+		}
+
+		if m.choosingCircle {
+			switch msg.String() {
+			case "up", "k":
+				m.circleCursor = clampCircle(m.circleCursor - 1)
+			case "down", "j":
+				m.circleCursor = clampCircle(m.circleCursor + 1)
+			case "1", "2", "3", "4", "5", "6", "7", "8", "9":
+				m.circleCursor = int(msg.String()[0] - '0')
+			case "left", "h":
+				m.instrumentPick = cycleInstrument(m.instrumentPick, -1)
+			case "right", "l":
+				m.instrumentPick = cycleInstrument(m.instrumentPick, 1)
+			case "enter":
+				m.chooseCircle(m.circleCursor)
+			case "esc":
+				m.choosingCircle = false
+			}
+			return m, nil
+		}
+
+		if m.choosingOrigins {
+			switch msg.String() {
+			case "up", "k":
+				m.moveOriginCursor(-1)
+			case "down", "j":
+				m.moveOriginCursor(1)
+			case " ", "x":
+				m.toggleOriginRow()
+			case "a":
+				m.toggleAllOrigins()
+			case "enter":
+				m.confirmOrigins()
+			case "esc":
+				m.choosingOrigins = false
+				m.openCirclePicker()
+			}
+			return m, nil
+		}
+
+		if m.gameOver {
+			switch msg.String() {
+			case "r":
+				m.resetRun()
+			case "c":
+				m.openCirclePicker()
+			}
+			return m, nil
+		}
+
+		if m.shopping {
+			switch msg.String() {
+			case "up", "k":
+				m.moveShopCursor(-1)
+			case "down", "j":
+				m.moveShopCursor(1)
+			case "enter":
+				m.buyShopItem()
+			case "esc":
+				m.leaveShop()
+			}
+			return m, nil
+		}
+
+		if m.eventing {
+			switch msg.String() {
+			case "up", "k":
+				m.moveEventCursor(-1)
+			case "down", "j":
+				m.moveEventCursor(1)
+			case "enter":
+				m.chooseEvent()
+			}
+			return m, nil
+		}
+
+		if m.resting {
+			switch msg.String() {
+			case "up", "k":
+				m.moveRestCursor(-1)
+			case "down", "j":
+				m.moveRestCursor(1)
+			case "enter":
+				m.chooseRest()
+			case "esc":
+				m.resting = false
+			}
+			return m, nil
+		}
+
 		if m.selectingSongs {
 			switch msg.String() {
 			case "up", "k":
@@ -84,6 +267,10 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.moveSongSelection(1)
 			case "enter", " ":
 				m.toggleSongSelection()
+			case "c":
+				m.confirmSelection()
+			case "r":
+				m.rerollSelectionPool()
 			case "esc":
 				m.selectingSongs = false
 				m.selectedSongs = nil
@@ -91,12 +278,26 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, nil
 		}
 
+		if m.confirmingStars {
+			switch msg.String() {
+			case "enter", "y":
+				m.confirmStars()
+			case "u", "backspace", "esc":
+				m.undoStar()
+			}
+			return m, nil
+		}
+
 		if m.enteringStars {
 			switch msg.String() {
 			case "backspace":
 				if len(m.starInput) > 0 {
 					m.starInput = m.starInput[:len(m.starInput)-1]
+				} else {
+					m.undoStar()
 				}
+			case "u":
+				m.undoStar()
 			case "enter":
 				m.submitStars()
 			case "0", "1", "2", "3", "4", "5", "6":
@@ -107,12 +308,17 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 		switch msg.String() {
 		case "r":
-			m.seed = time.Now().UnixNano()
 			m.resetRun()
+		case "c":
+			m.openCirclePicker()
 		case "left", "h":
 			m.moveHorizontal(-1)
 		case "right", "l":
 			m.moveHorizontal(1)
+		case "up", "k":
+			m.browseRow(-1)
+		case "down", "j":
+			m.browseRow(1)
 		case "enter":
 			m.commitSelection()
 		case "]":
@@ -132,13 +338,29 @@ func (m model) View() string {
 		Underline(true).
 		Render("Long Way To The Top")
 
+	if m.resumePrompt {
+		return m.resumeView(title)
+	}
+	if m.choosingCircle {
+		return m.circlePickerView(title)
+	}
+	if m.choosingOrigins {
+		return m.originPickerView(title)
+	}
+	if m.gameOver {
+		return m.gameOverView(title)
+	}
+
 	sub := lipgloss.NewStyle().
 		Foreground(lipgloss.Color("#9AE6FF")).
 		Render("Three-act rhythm roguelike — routes like Slay the Spire, resolved by rhythm.")
 
-	controls := "Controls: r rerolls the route • q quits"
-	navigation := "Navigation: ←/→ (h/l) move across row • enter commits and enters stars • [ ] switch act"
-	legend := "Legend: C Challenge (preview hides song list until selected)"
+	controls := "Controls: r rerolls the route • c picks a circle • q quits"
+	navigation := "Navigation: ←/→ (h/l) move across row • enter commits • space picks songs, c confirms • [ ] browse unlocked acts"
+	if m.readOnly() {
+		navigation = "Navigation: ←/→ (h/l) and ↑/↓ (k/j) browse this act's nodes • [ ] switch act"
+	}
+	legend := "Legend: C Challenge (preview hides song list until selected) • S Shop • E Elite • R Rest • ? Event • B Boss"
 
 	actView := renderAct(m.acts[m.currentAct], m.cursorRow, m.cursorCol)
 	body := lipgloss.JoinVertical(lipgloss.Left, actView)
@@ -146,6 +368,9 @@ func (m model) View() string {
 	preview := renderNodePreview(m.selectedNode(), &m)
 	if m.enteringStars && len(m.selectedSongs) > 0 {
 		preview += fmt.Sprintf("\nStars for song %d/%d [0-6]: %s", m.starEntryIdx+1, len(m.selectedSongs), m.starInput)
+		if len(m.starUndo) > 0 {
+			preview += "  (u undoes the last entry)"
+		}
 	}
 	previewBox := lipgloss.NewStyle().
 		Border(lipgloss.RoundedBorder()).
@@ -165,7 +390,24 @@ func (m model) View() string {
 		title,
 		sub,
 		fmt.Sprintf("Seed: %d", m.seed),
-		fmt.Sprintf("Act %d/%d", m.currentAct+1, len(m.acts)),
+		fmt.Sprintf("Act %d/%d%s • Circle %d (%s) • %s", m.currentAct+1, len(m.acts), actStatus(&m), m.circle, circleLabel(m.circle), m.instrument.label()),
+		renderVoltage(m.voltage, m.lastLoss),
+		renderWallet(&m),
+	)
+	if shape := m.shape(); !shape.isStandard() {
+		doc = lipgloss.JoinVertical(lipgloss.Left, doc, "Run shape: "+shape.summary())
+	}
+	if m.eventMessage != "" && !m.eventing {
+		doc = lipgloss.JoinVertical(lipgloss.Left, doc, shopStyle.Render(m.eventMessage))
+	}
+	if m.notice != "" {
+		doc = lipgloss.JoinVertical(lipgloss.Left, doc, shopStyle.Render(m.notice))
+	}
+	if m.saveErr != nil {
+		doc = lipgloss.JoinVertical(lipgloss.Left, doc, lowVoltageStyle.Render("Autosave failed: "+m.saveErr.Error()))
+	}
+	doc = lipgloss.JoinVertical(lipgloss.Left,
+		doc,
 		"",
 		bodyBox,
 		"",
@@ -183,6 +425,201 @@ func (m model) View() string {
 	return doc
 }
 
+func (m model) gameOverView(title string) string {
+	headline := lowVoltageStyle.Render("GAME OVER — your rig ran out of voltage.")
+	var cleared int
+	for i := range max(1, len(m.actRuns)) {
+		_, runs := m.actState(i)
+		for _, run := range runs {
+			if len(run.stars) > 0 {
+				cleared++
+			}
+		}
+	}
+	doc := lipgloss.JoinVertical(lipgloss.Left,
+		title,
+		"",
+		headline,
+		"",
+		fmt.Sprintf("Seed: %d", m.seed),
+		fmt.Sprintf("Reached act %d/%d, row %d", m.currentAct+1, len(m.acts), m.cursorRow+1),
+		fmt.Sprintf("Challenges submitted this run: %d", cleared),
+		"",
+		"Controls: r starts a new run • c picks a circle • q quits",
+	)
+	box := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(lipgloss.Color("#F38BA8")).
+		Padding(1, 2).
+		Render(doc)
+
+	if m.height > 0 {
+		return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, box)
+	}
+	return box
+}
+
+func (m model) resumeView(title string) string {
+	lines := []string{title, "", "A saved run was found."}
+	if m.pendingSave != nil {
+		save := m.pendingSave
+		lines = append(lines,
+			"",
+			fmt.Sprintf("Seed: %d", save.Seed),
+			fmt.Sprintf("Act %d • Row %d • Circle %d", save.CurrentAct+1, save.CurrentRow+1, clampCircle(save.Circle)),
+			"Voltage: "+formatVoltage(save.Voltage),
+		)
+		if save.LastSaved > 0 {
+			lines = append(lines, "Saved: "+time.UnixMilli(save.LastSaved).Format("2006-01-02 15:04"))
+		}
+	}
+	if m.saveErr != nil {
+		lines = append(lines, "", lowVoltageStyle.Render("Could not resume: "+m.saveErr.Error()))
+	}
+	lines = append(lines, "", "Controls: enter (c) Continue • n New run • q quits")
+
+	box := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(lipgloss.Color("#6C7086")).
+		Padding(1, 2).
+		Render(lipgloss.JoinVertical(lipgloss.Left, lines...))
+
+	if m.height > 0 {
+		return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, box)
+	}
+	return box
+}
+
+func (m model) circlePickerView(title string) string {
+	var b strings.Builder
+	for c := minCircle; c <= maxCircle; c++ {
+		cursor := "  "
+		line := fmt.Sprintf("Circle %d — %s", c, circleLabel(c))
+		if c == m.circleCursor {
+			cursor = "> "
+			line = selectedNodeStyle.Render(line)
+		}
+		b.WriteString(cursor + line + "\n")
+	}
+
+	doc := lipgloss.JoinVertical(lipgloss.Left,
+		title,
+		"",
+		"Choose your Circle of Hell. Higher circles gate songs to harder intensities.",
+		"",
+		fmt.Sprintf("Instrument: ‹ %s › — difficulty tiers and filters follow this part", m.instrumentPick.label()),
+		"",
+		strings.TrimRight(b.String(), "\n"),
+		"",
+		"Controls: ↑/↓ (k/j) or 1-9 choose circle • ←/→ (h/l) instrument • enter continues • esc cancels • q quits",
+	)
+	box := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(lipgloss.Color("#6C7086")).
+		Padding(1, 2).
+		Render(doc)
+
+	if m.height > 0 {
+		return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, box)
+	}
+	return box
+}
+
+func (m model) originPickerView(title string) string {
+	rows := originPickerRows(m.originGroups)
+	start := 0
+	if m.originCursor >= originPickerWindow {
+		start = m.originCursor - originPickerWindow + 1
+	}
+	end := min(len(rows), start+originPickerWindow)
+
+	var b strings.Builder
+	for i := start; i < end; i++ {
+		row := rows[i]
+		cursor := "  "
+		if i == m.originCursor {
+			cursor = "> "
+		}
+		var line string
+		if row.origin == "" {
+			line = fmt.Sprintf("%s %s", m.seriesMark(row.series), row.series)
+			line = nodeStyle.Render(line)
+		} else {
+			mark := "[ ]"
+			if m.pendingOrigins[row.origin] {
+				mark = "[x]"
+			}
+			line = fmt.Sprintf("    %s %s (%d)", mark, row.origin, m.originCounts[row.origin])
+		}
+		if i == m.originCursor {
+			line = selectedNodeStyle.Render(line)
+		}
+		b.WriteString(cursor + line + "\n")
+	}
+
+	selected := len(originList(m.pendingOrigins))
+	status := fmt.Sprintf("%d origins selected", selected)
+	if selected == 0 {
+		status = "No origins selected — every origin will be used."
+	}
+
+	doc := lipgloss.JoinVertical(lipgloss.Left,
+		title,
+		"",
+		fmt.Sprintf("Circle %d (%s). Choose which song origins to draw from.", m.circle, circleLabel(m.circle)),
+		status,
+		"",
+		strings.TrimRight(b.String(), "\n"),
+		"",
+		"Controls: ↑/↓ (k/j) move • space toggles (series toggles all) • a toggles everything • enter starts the run • esc back • q quits",
+	)
+	box := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(lipgloss.Color("#6C7086")).
+		Padding(1, 2).
+		Render(doc)
+
+	if m.height > 0 {
+		return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, box)
+	}
+	return box
+}
+
+func (m model) seriesMark(series string) string {
+	total, picked := 0, 0
+	for _, g := range m.originGroups {
+		if g.series != series {
+			continue
+		}
+		for _, o := range g.origins {
+			total++
+			if m.pendingOrigins[o] {
+				picked++
+			}
+		}
+	}
+	switch {
+	case picked == 0:
+		return "[ ]"
+	case picked == total:
+		return "[x]"
+	default:
+		return "[-]"
+	}
+}
+
+func renderVoltage(v, lastLoss int) string {
+	style := voltageStyle
+	if v <= lowVoltageThreshold {
+		style = lowVoltageStyle
+	}
+	line := "Voltage: " + style.Render(fmt.Sprintf("%s / %s", formatVoltage(v), formatVoltage(startingVoltage)))
+	if lastLoss > 0 {
+		line += fmt.Sprintf(" (last challenge -%s)", formatVoltage(lastLoss))
+	}
+	return line
+}
+
 func (m model) selectedNode() *node {
 	if m.currentAct < 0 || m.currentAct >= len(m.acts) {
 		return nil
@@ -198,54 +635,185 @@ func (m model) selectedNode() *node {
 	return &row[m.cursorCol]
 }
 
-func (m *model) nextAct() {
-	if m.currentAct+1 >= len(m.acts) {
+func (m *model) resetRun() {
+	m.seed = time.Now().UnixNano()
+	m.runShape = m.config
+	m.acts = generateShapedRun(m.shape(), m.seed, m.runSongs(), m.circle, customChallenges)
+	m.currentAct = 0
+	m.voltage = startingVoltage
+	m.lastLoss = 0
+	m.gameOver = false
+	m.currency = 0
+	m.rerolls = 0
+	m.rerollCount = 0
+	m.redraws = nil
+	m.extraSlots = 0
+	m.purchased = make(map[string]bool)
+	m.played = make(map[string]bool)
+	m.difficultyCap = 0
+	m.resetProgress()
+	m.enterAct(0)
+	m.autosave()
+}
+
+// shape is the current map's configuration, falling back to the standard
+// run for models built without one. A resumed run keeps its saved shape
+// while m.config still shapes the next new run.
+func (m model) shape() runConfig {
+	if m.runShape.Acts == 0 {
+		return standardRun
+	}
+	return m.runShape
+}
+
+func (m *model) offerResume(save savedRun) {
+	// origin filters carry over even if the player starts a new run
+	m.selectedOrigins = originSet(save.SelectedOrigins)
+	m.pendingSave = &save
+	m.resumePrompt = true
+	m.choosingCircle = false
+}
+
+func (m *model) resumeSaved() {
+	if m.pendingSave == nil {
+		m.resumePrompt = false
 		return
 	}
-	m.currentAct++
-	m.resetAct()
+	// restore into a copy so a save that fails half way leaves the fresh run
+	// intact behind the circle picker
+	next := *m
+	if err := next.restoreSave(*m.pendingSave); err != nil {
+		m.saveErr = err
+		m.pendingSave = nil
+		m.openCirclePicker()
+		m.resumePrompt = false
+		return
+	}
+	*m = next
+	m.pendingSave = nil
+	m.resumePrompt = false
+	m.choosingCircle = false
+}
+
+func (m *model) openCirclePicker() {
+	m.choosingCircle = true
+	m.circleCursor = clampCircle(m.circle)
+	m.instrumentPick = m.instrument
 }
 
-func (m *model) prevAct() {
-	if m.currentAct == 0 {
+func (m *model) chooseCircle(circle int) {
+	m.circle = clampCircle(circle)
+	m.instrument = m.instrumentPick
+	m.choosingCircle = false
+	if len(m.originGroups) == 0 {
+		m.resetRun()
 		return
 	}
-	m.currentAct--
-	m.resetAct()
+	m.openOriginPicker()
 }
 
-func (m *model) resetAct() {
-	m.cursorRow = 0
-	m.cursorCol = 0
-	m.allowed = initAllowed(m.acts[m.currentAct])
-	m.allowedIdx = 0
-	m.committed = make(map[int]int)
-	m.runs = make(map[int]nodeRun)
-	m.selectingSongs = false
-	m.enteringStars = false
-	m.selectionPool = nil
-	m.selectionIdx = 0
-	m.selectedSongs = nil
-	m.selectedStars = nil
-	m.starEntryIdx = 0
-	m.starInput = ""
+// runSongs is the catalog a new run draws from after origin filtering,
+// re-tiered for the run's instrument.
+func (m model) runSongs() []song {
+	return songsForInstrument(filterSongsByOrigin(m.songs, m.sources, m.selectedOrigins), m.instrument)
 }
 
-func (m *model) resetRun() {
-	m.seed = time.Now().UnixNano()
-	m.acts = generateRun(m.seed, m.songs)
-	m.currentAct = 0
-	m.resetAct()
+func (m *model) openOriginPicker() {
+	m.choosingOrigins = true
+	m.originCursor = 0
+	m.pendingOrigins = make(map[string]bool)
+	for _, g := range m.originGroups {
+		for _, o := range g.origins {
+			if len(m.selectedOrigins) == 0 || m.selectedOrigins[o] {
+				m.pendingOrigins[o] = true
+			}
+		}
+	}
 }
 
+func (m *model) moveOriginCursor(delta int) {
+	rows := originPickerRows(m.originGroups)
+	if len(rows) == 0 {
+		return
+	}
+	m.originCursor = max(0, min(len(rows)-1, m.originCursor+delta))
+}
+
+func (m *model) toggleOriginRow() {
+	rows := originPickerRows(m.originGroups)
+	if m.originCursor < 0 || m.originCursor >= len(rows) {
+		return
+	}
+	row := rows[m.originCursor]
+	if row.origin != "" {
+		m.pendingOrigins[row.origin] = !m.pendingOrigins[row.origin]
+		return
+	}
+	for _, g := range m.originGroups {
+		if g.series != row.series {
+			continue
+		}
+		all := true
+		for _, o := range g.origins {
+			all = all && m.pendingOrigins[o]
+		}
+		for _, o := range g.origins {
+			m.pendingOrigins[o] = !all
+		}
+	}
+}
+
+func (m *model) toggleAllOrigins() {
+	all := true
+	for _, g := range m.originGroups {
+		for _, o := range g.origins {
+			all = all && m.pendingOrigins[o]
+		}
+	}
+	for _, g := range m.originGroups {
+		for _, o := range g.origins {
+			m.pendingOrigins[o] = !all
+		}
+	}
+}
+
+// confirmOrigins stores the picker selection for this and later runs. A full
+// (or empty) selection is kept as nil so newly added origins are included.
+func (m *model) confirmOrigins() {
+	picked := originSet(originList(m.pendingOrigins))
+	total := 0
+	for _, g := range m.originGroups {
+		total += len(g.origins)
+	}
+	if len(picked) == total {
+		picked = nil
+	}
+	m.selectedOrigins = picked
+	m.choosingOrigins = false
+	m.pendingOrigins = nil
+	m.resetRun()
+}
+
+// renderAct draws the act as a grid of node glyphs with connector lines
+// between rows. A gap gets one connector line per column the longest edge
+// crosses, so diagonals are drawn end to end instead of as a single mark.
 func renderAct(a act, selectedRow, selectedCol int) string {
-	height := (len(a.rows) * 2) - 1
+	rowY := make([]int, len(a.rows))
 	maxCols := 0
-	for _, row := range a.rows {
-		if len(row) > maxCols {
-			maxCols = len(row)
+	for r, row := range a.rows {
+		maxCols = max(maxCols, len(row))
+		if r == 0 {
+			continue
+		}
+		gap := 1
+		for _, n := range a.rows[r-1] {
+			for _, target := range n.edges {
+				gap = max(gap, abs(target-n.col))
+			}
 		}
+		rowY[r] = rowY[r-1] + gap + 1
 	}
+	height := rowY[len(rowY)-1] + 1
 	width := maxCols*colSpacing + 1
 
 	grid := make([][]rune, height)
@@ -257,25 +825,25 @@ func renderAct(a act, selectedRow, selectedCol int) string {
 	}
 
 	for rowIdx, row := range a.rows {
-		y := rowIdx * 2
+		y := rowY[rowIdx]
 		for _, n := range row {
 			x := n.col * colSpacing
 			grid[y][x] = nodeGlyph(n)
 			if rowIdx == len(a.rows)-1 {
 				continue
 			}
+			steps := rowY[rowIdx+1] - y
 			for _, target := range n.edges {
 				tx := target * colSpacing
-				connY := y + 1
-				connX := x
+				mark := '|'
 				if tx > x {
-					connX = x + (tx-x)/2
-					grid[connY][connX] = '\\'
+					mark = '\\'
 				} else if tx < x {
-					connX = x - (x-tx)/2
-					grid[connY][connX] = '/'
-				} else {
-					grid[connY][connX] = '|'
+					mark = '/'
+				}
+				for t := 1; t < steps; t++ {
+					connX := x + jsRound(float64((tx-x)*t)/float64(steps))
+					grid[y+t][connX] = mark
 				}
 			}
 		}
@@ -286,7 +854,7 @@ func renderAct(a act, selectedRow, selectedCol int) string {
 		var b strings.Builder
 		for j, ch := range r {
 			if selectedRow >= 0 && selectedCol >= 0 &&
-				i == selectedRow*2 && j == selectedCol*colSpacing && ch != ' ' {
+				selectedRow < len(rowY) && i == rowY[selectedRow] && j == selectedCol*colSpacing && ch != ' ' {
 				b.WriteString(selectedNodeStyle.Render(string(ch)))
 			} else {
 				if ch == 'C' {
@@ -316,6 +884,12 @@ func nodeGlyph(n node) rune {
 		return 'S'
 	case nodeBoss:
 		return 'B'
+	case nodeElite:
+		return 'E'
+	case nodeRest:
+		return 'R'
+	case nodeUnknown:
+		return '?'
 	default:
 		return 'o'
 	}
@@ -327,13 +901,27 @@ func renderNodePreview(n *node, m *model) string {
 	}
 
 	switch n.kind {
-	case nodeChallenge:
+	case nodeChallenge, nodeElite, nodeBoss:
 		if n.challenge == nil {
 			return "Challenge: unknown\nSummary: missing"
 		}
 		var b strings.Builder
-		b.WriteString(fmt.Sprintf("Challenge: %s\n", n.challenge.name))
+		if n.kind == nodeBoss {
+			b.WriteString(fmt.Sprintf("Boss: %s\n", n.challenge.name))
+		} else {
+			b.WriteString(fmt.Sprintf("Challenge: %s\n", n.challenge.name))
+		}
 		b.WriteString(fmt.Sprintf("Summary: %s\n", n.challenge.summary))
+		if rule := n.challenge.boss; rule != nil {
+			b.WriteString(rule.summary() + "\n")
+		} else if n.challenge.goal > 0 {
+			b.WriteString(fmt.Sprintf("Goal: average %d★\n", n.challenge.goal))
+		}
+		if rule := n.challenge.elite; rule != nil {
+			b.WriteString(rule.summary() + "\n")
+			b.WriteString(fmt.Sprintf("Reward: %s and a reroll token; each song under %d★ costs %s V extra.\n",
+				formatCurrency(eliteBonus), rule.minStars, formatVoltage(voltagePenaltyPerMissingStar)))
+		}
 
 		var songsToShow []song
 		var stars []int
@@ -341,8 +929,13 @@ func renderNodePreview(n *node, m *model) string {
 		var entering bool
 		var currentStarIdx int
 		var selectedIDs map[string]struct{}
+		var result *nodeRun
+		tierLabel := "diff"
 
 		if m != nil {
+			if m.instrument != "" && m.instrument != instrumentBand {
+				tierLabel = strings.ToLower(m.instrument.label())
+			}
 			selecting = m.selectingSongs
 			entering = m.enteringStars
 			currentStarIdx = m.starEntryIdx
@@ -351,17 +944,29 @@ func renderNodePreview(n *node, m *model) string {
 				selectedIDs[songKey(s)] = struct{}{}
 			}
 
-			if m.selectingSongs || m.enteringStars {
+			if m.selectingSongs {
 				songsToShow = m.selectionPool
+			} else if m.enteringStars || m.confirmingStars {
+				songsToShow = m.selectedSongs
 				stars = m.selectedStars
-			} else if run, ok := m.runs[m.cursorRow]; ok {
+			} else if run, ok := m.runs[m.cursorRow]; ok && run.col == m.cursorCol {
 				songsToShow = run.songs
 				stars = run.stars
+				if len(run.stars) > 0 {
+					result = &run
+				}
+			} else if m.practiced(m.cursorRow, n.col) {
+				songsToShow = n.challenge.songs
+				b.WriteString("Practiced: the pool is known ahead of time.\n")
 			}
 		}
 
 		if len(songsToShow) == 0 {
-			b.WriteString("\nSongs: ???")
+			if n.kind == nodeBoss {
+				b.WriteString("\nThe boss's setlist stays secret until you step up.")
+			} else {
+				b.WriteString("\nSongs: ???")
+			}
 			return b.String()
 		}
 
@@ -389,34 +994,131 @@ func renderNodePreview(n *node, m *model) string {
 				line += fmt.Sprintf(" [%s]", s.length)
 			}
 			if s.difficulty > 0 {
-				line += fmt.Sprintf(" • diff %d/6", s.difficulty)
+				line += fmt.Sprintf(" • %s %d/6", tierLabel, s.difficulty)
 			}
 			if s.genre != "" {
 				line += fmt.Sprintf(" • %s", s.genre)
 			}
+			if selecting && m.played[songKey(s)] {
+				line += " • played"
+			}
 			if i < len(stars) && stars[i] > 0 {
 				line += fmt.Sprintf(" • stars %d", stars[i])
 			}
 			b.WriteString(line + "\n")
 		}
+		if selecting {
+			line := fmt.Sprintf("\nSelected %d of %d", len(m.selectedSongs), m.requiredSelection())
+			if limit := m.selectLimit(); limit > m.requiredSelection() {
+				line += fmt.Sprintf(" (encore slot: up to %d)", limit)
+			}
+			line += " • space toggles • c confirms"
+			if m.difficultyCap > 0 {
+				line += fmt.Sprintf(" • broken string: difficulty %d or lower", m.difficultyCap)
+			}
+			if m.rerolls > 0 && n.kind == nodeChallenge {
+				line += " • r rerolls the pool"
+			}
+			b.WriteString(line + "\n")
+			if m.selectMessage != "" {
+				b.WriteString(lowVoltageStyle.Render(m.selectMessage) + "\n")
+			}
+		}
+		if result != nil {
+			b.WriteString(renderOutcome(n, *result) + "\n")
+		}
+		if m != nil && m.confirmingStars {
+			b.WriteString(renderConfirmation(n, m) + "\n")
+		}
 		return strings.TrimRight(b.String(), "\n")
-	case nodeBoss:
-		return "It's the boss!!!"
 	case nodeShop:
-		return "Shop: Browse gear (coming soon)."
+		return renderShopPreview(m)
+	case nodeRest:
+		return renderRestPreview(m)
+	case nodeUnknown:
+		return renderEventPreview(n, m)
 	default:
 		return "Unknown node."
 	}
 }
 
+// renderConfirmation previews what confirming the entered stars will do.
+func renderConfirmation(n *node, m *model) string {
+	charged, encore := m.chargedStars(m.selectedStars)
+	passed, loss, bonus := resolveChallenge(n, charged)
+	lines := []string{"\nConfirm these results?", renderOutcome(n, nodeRun{stars: charged, passed: passed})}
+	effects := fmt.Sprintf("Voltage -%s V • earns %s", formatVoltage(loss), formatCurrency(currencyForStars(m.selectedStars)+bonus))
+	if encore {
+		effects += " • the encore slot drops your lowest song"
+	}
+	lines = append(lines, effects, "enter locks the row in • u (or backspace) undoes the last entry")
+	return strings.Join(lines, "\n")
+}
+
+func renderOutcome(n *node, run nodeRun) string {
+	avg := fmt.Sprintf("average %.1f★", averageStars(run.stars))
+	switch {
+	case n.kind == nodeBoss && run.passed:
+		return nodeStyle.Render("Boss defeated! (" + avg + ")")
+	case n.kind == nodeBoss:
+		return lowVoltageStyle.Render("The boss held on. (" + avg + ")")
+	case n.kind == nodeElite && run.passed:
+		return nodeStyle.Render("Elite cleared! (" + avg + ")")
+	case n.kind == nodeElite:
+		return lowVoltageStyle.Render("The elite held on. (" + avg + ")")
+	case n.challenge.goal == 0:
+		return "Result: " + avg
+	case run.passed:
+		return nodeStyle.Render(fmt.Sprintf("Goal met: %s vs %d★", avg, n.challenge.goal))
+	default:
+		return lowVoltageStyle.Render(fmt.Sprintf("Goal missed: %s vs %d★", avg, n.challenge.goal))
+	}
+}
+
 func main() {
-	songs, err := loadSongs(songsFile)
+	if len(os.Args) > 1 && os.Args[1] == "catalog" {
+		os.Exit(runCatalogCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "challenges" {
+		os.Exit(runChallengesCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	catalog := flag.String("catalog", songsFile, "song catalog to load (.json or .csv)")
+	challenges := flag.String("challenges", challengesFile, "custom challenge definitions (skipped if the default file is missing)")
+	shapeFlags := addRunConfigFlags(flag.CommandLine)
+	flag.Parse()
+
+	cfg, err := shapeFlags.resolve()
+	if err != nil {
+		fmt.Println("could not load run config:", err)
+		os.Exit(1)
+	}
+
+	defs, err := loadChallengeDefs(*challenges)
+	switch {
+	case err == nil:
+		customChallenges = defs
+	case !(os.IsNotExist(err) && *challenges == challengesFile):
+		fmt.Println("could not load challenges:", err)
+		os.Exit(1)
+	}
+
+	songs, err := loadSongs(*catalog)
 	if err != nil {
 		fmt.Println("could not load songs:", err)
 		os.Exit(1)
 	}
 
-	m := newModel(songs)
+	m := newShapedModel(songs, cfg)
+	if sources, err := loadSourceInfo(sourceInfoFile); err == nil {
+		m.setSources(sources)
+	}
+	if path, err := defaultSavePath(); err == nil {
+		m.savePath = path
+		if save, err := readSave(path); err == nil {
+			m.offerResume(save)
+		}
+	}
 	if _, err := tea.NewProgram(m, tea.WithAltScreen()).Run(); err != nil {
 		fmt.Println("could not start program:", err)
 		os.Exit(1)
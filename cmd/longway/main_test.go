@@ -1,7 +1,10 @@
 package main
 
 import (
-	"math/rand"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -18,7 +21,7 @@ func TestGenerateRunCreatesChallengeNodes(t *testing.T) {
 		{title: "Through the Fire and Flames", artist: "DragonForce", length: "7:24", seconds: 444, year: 2006, difficulty: 6},
 		{title: "Knights of Cydonia", artist: "Muse", length: "6:06", seconds: 366, year: 2006, difficulty: 5},
 	}
-	acts := generateRun(seed, songs)
+	acts := generateRun(seed, songs, 7)
 
 	if len(acts) != totalActs {
 		t.Fatalf("expected %d acts, got %d", totalActs, len(acts))
@@ -42,8 +45,11 @@ func TestGenerateRunCreatesChallengeNodes(t *testing.T) {
 				if n.kind == nodeShop {
 					continue
 				}
-				if n.kind != nodeChallenge {
-					t.Fatalf("act %d row %d col %d kind = %v, want %v", a.index, rowIdx, colIdx, n.kind, nodeChallenge)
+				if n.kind == nodeRest || n.kind == nodeUnknown {
+					continue
+				}
+				if n.kind != nodeChallenge && n.kind != nodeElite {
+					t.Fatalf("act %d row %d col %d kind = %v, want challenge or elite", a.index, rowIdx, colIdx, n.kind)
 				}
 				if n.challenge == nil {
 					t.Fatalf("act %d row %d col %d missing challenge", a.index, rowIdx, colIdx)
@@ -100,6 +106,11 @@ func TestSwitchActResetsCursor(t *testing.T) {
 	m.cursorRow = 0
 	m.cursorCol = 1
 
+	m.nextAct()
+	if m.currentAct != 0 || m.notice == "" {
+		t.Fatalf("act 2 should stay locked until act 1's boss is resolved")
+	}
+	m.progressAct = 1
 	m.nextAct()
 	if m.currentAct != 1 {
 		t.Fatalf("expected currentAct 1, got %d", m.currentAct)
@@ -190,7 +201,7 @@ func TestLoadSongsSupportsSecondsColumn(t *testing.T) {
 }
 
 func TestNewDecadeChallengePicksSameDecade(t *testing.T) {
-	rng := rand.New(rand.NewSource(1))
+	rng := newMulberry32(1)
 	songs := []song{
 		{title: "SongA", artist: "A", year: 1981, difficulty: 2},
 		{title: "SongB", artist: "B", year: 1982, difficulty: 2},
@@ -198,7 +209,7 @@ func TestNewDecadeChallengePicksSameDecade(t *testing.T) {
 		{title: "Other", artist: "D", year: 1999, difficulty: 2},
 	}
 
-	ch, ok := newDecadeChallenge(songs, rng, challengeSongListSize)
+	ch, ok := newDecadeChallenge(songs, rng, challengeSongListSize, 3)
 	if !ok {
 		t.Fatalf("expected decade challenge")
 	}
@@ -213,7 +224,7 @@ func TestNewDecadeChallengePicksSameDecade(t *testing.T) {
 }
 
 func TestNewLongSongChallengePicksLongTracks(t *testing.T) {
-	rng := rand.New(rand.NewSource(1))
+	rng := newMulberry32(1)
 	songs := []song{
 		{title: "Short", seconds: 200, difficulty: 2},
 		{title: "LongA", seconds: 301, difficulty: 2},
@@ -221,7 +232,7 @@ func TestNewLongSongChallengePicksLongTracks(t *testing.T) {
 		{title: "LongC", seconds: 500, difficulty: 2},
 	}
 
-	ch, ok := newLongSongChallenge(songs, rng, challengeSongListSize)
+	ch, ok := newLongSongChallenge(songs, rng, challengeSongListSize, 3)
 	if !ok {
 		t.Fatalf("expected long song challenge")
 	}
@@ -236,7 +247,7 @@ func TestNewLongSongChallengePicksLongTracks(t *testing.T) {
 }
 
 func TestNewGenreChallengeUsesSameGenre(t *testing.T) {
-	rng := rand.New(rand.NewSource(2))
+	rng := newMulberry32(2)
 	songs := []song{
 		{title: "SongA", artist: "A", genre: "Rock", difficulty: 2},
 		{title: "SongB", artist: "B", genre: "Rock", difficulty: 2},
@@ -244,7 +255,7 @@ func TestNewGenreChallengeUsesSameGenre(t *testing.T) {
 		{title: "SongD", artist: "D", genre: "Pop", difficulty: 2},
 	}
 
-	ch, ok := newGenreChallenge(songs, rng, challengeSongListSize)
+	ch, ok := newGenreChallenge(songs, rng, challengeSongListSize, 3)
 	if !ok {
 		t.Fatalf("expected genre challenge")
 	}
@@ -259,7 +270,7 @@ func TestNewGenreChallengeUsesSameGenre(t *testing.T) {
 }
 
 func TestNewDifficultyChallengeUsesTier(t *testing.T) {
-	rng := rand.New(rand.NewSource(3))
+	rng := newMulberry32(3)
 	songs := []song{
 		{title: "Lvl1-A", difficulty: 1},
 		{title: "Lvl1-B", difficulty: 1},
@@ -268,7 +279,7 @@ func TestNewDifficultyChallengeUsesTier(t *testing.T) {
 		{title: "Lvl4", difficulty: 4},
 	}
 
-	ch, ok := newDifficultyChallenge(songs, rng, challengeSongListSize)
+	ch, ok := newDifficultyChallenge(songs, rng, challengeSongListSize, 3)
 	if !ok {
 		t.Fatalf("expected difficulty challenge")
 	}
@@ -314,24 +325,24 @@ func TestApplyActDifficultyConstraints(t *testing.T) {
 }
 
 func TestPickPoolSizePerAct(t *testing.T) {
-	rng := rand.New(rand.NewSource(5))
+	rng := newMulberry32(5)
 
-	size1 := pickPoolSize(1, 20, rng)
+	size1 := pickPoolSize(standardRun, 1, 20, rng)
 	if size1 < 9 || size1 > 12 {
 		t.Fatalf("act1 pool size out of range: %d", size1)
 	}
 
-	size2 := pickPoolSize(2, 20, rng)
+	size2 := pickPoolSize(standardRun, 2, 20, rng)
 	if size2 < 6 || size2 > 9 {
 		t.Fatalf("act2 pool size out of range: %d", size2)
 	}
 
-	size3 := pickPoolSize(3, 20, rng)
+	size3 := pickPoolSize(standardRun, 3, 20, rng)
 	if size3 < 3 || size3 > 5 {
 		t.Fatalf("act3 pool size out of range: %d", size3)
 	}
 
-	clamped := pickPoolSize(1, 5, rng)
+	clamped := pickPoolSize(standardRun, 1, 5, rng)
 	if clamped != 5 {
 		t.Fatalf("pool size should clamp to available: got %d want 5", clamped)
 	}
@@ -343,14 +354,14 @@ func TestBossIsLastRow(t *testing.T) {
 		{title: "Bohemian Rhapsody", artist: "Queen", difficulty: 6, seconds: 355},
 		{title: "Other", artist: "X", difficulty: 3, seconds: 200},
 	}
-	acts := generateRun(seed, songs)
+	acts := generateRun(seed, songs, 7)
 	for _, a := range acts {
 		last := a.rows[len(a.rows)-1]
 		if len(last) != 1 || last[0].kind != nodeBoss {
 			t.Fatalf("last row not boss: %+v", last)
 		}
-		if last[0].challenge == nil || last[0].challenge.songs[0].title != "Bohemian Rhapsody" {
-			t.Fatalf("boss challenge missing Bohemian Rhapsody: %+v", last[0].challenge)
+		if last[0].challenge == nil || last[0].challenge.boss == nil || len(last[0].challenge.songs) == 0 {
+			t.Fatalf("boss challenge missing: %+v", last[0].challenge)
 		}
 		// verify connectivity: every node except first row should have incoming edge
 		incoming := make([][]int, len(a.rows))
@@ -388,3 +399,2601 @@ func TestCtrlCAlwaysQuits(t *testing.T) {
 		t.Fatalf("expected QuitMsg, got %T", msg)
 	}
 }
+
+func TestVoltageLossChargesMissingStars(t *testing.T) {
+	if got := voltageLoss([]int{5}); got != 1000 {
+		t.Fatalf("5-star song should cost 1000, got %d", got)
+	}
+	if got := voltageLoss([]int{0}); got != 6000 {
+		t.Fatalf("0-star song should cost 6000, got %d", got)
+	}
+	if got := voltageLoss([]int{6, 6, 4}); got != 2000 {
+		t.Fatalf("expected 2000 for 6/6/4, got %d", got)
+	}
+
+	remaining, loss := applyVoltageLoss(3000, []int{0, 0})
+	if remaining != 0 || loss != 12000 {
+		t.Fatalf("voltage should floor at zero: remaining %d loss %d", remaining, loss)
+	}
+}
+
+func TestSubmitStarsDrainsVoltageAndEndsRun(t *testing.T) {
+	songs := []song{
+		{id: "a", title: "A", artist: "X", difficulty: 1},
+		{id: "b", title: "B", artist: "X", difficulty: 1},
+	}
+	a := act{
+		index: 1,
+		rows: [][]node{
+			{{col: 0, kind: nodeChallenge, edges: []int{0}, challenge: &challenge{songs: songs}}},
+			{{col: 0, kind: nodeBoss}},
+		},
+	}
+	m := model{
+		acts:      []act{a},
+		allowed:   []int{0},
+		committed: map[int]int{},
+		runs:      map[int]nodeRun{},
+		voltage:   startingVoltage,
+	}
+
+	m.commitSelection()
+	m.selectedSongs = songs
+	m.startStarEntry()
+	for _, v := range []string{"5", "4"} {
+		m.starInput = v
+		m.submitStars()
+	}
+	m.confirmStars()
+	if m.voltage != startingVoltage-3000 {
+		t.Fatalf("expected voltage %d, got %d", startingVoltage-3000, m.voltage)
+	}
+	if m.gameOver {
+		t.Fatalf("run should not be over yet")
+	}
+
+	m.voltage = 1000
+	m.cursorRow = 0
+	delete(m.runs, 0) // replay the row as if it were a fresh one
+	m.commitSelection()
+	m.selectedSongs = songs
+	m.startStarEntry()
+	for _, v := range []string{"0", "0"} {
+		m.starInput = v
+		m.submitStars()
+	}
+	m.confirmStars()
+	if m.voltage != 0 || !m.gameOver {
+		t.Fatalf("expected game over at zero voltage, got voltage %d gameOver %v", m.voltage, m.gameOver)
+	}
+	if !strings.Contains(m.View(), "GAME OVER") {
+		t.Fatalf("expected game over screen")
+	}
+}
+
+func TestApplyCircleIntensityConstraints(t *testing.T) {
+	songs := []song{
+		{title: "Zero", difficulty: 0},
+		{title: "Two", difficulty: 2},
+		{title: "Four", difficulty: 4},
+		{title: "Six", difficulty: 6},
+	}
+
+	for circle, band := range circleIntensityBounds {
+		filtered := applyCircleIntensityConstraints(circle, songs)
+		if len(filtered) == 0 {
+			t.Fatalf("circle %d filtered everything", circle)
+		}
+		for _, s := range filtered {
+			if s.difficulty < band.min || s.difficulty > band.max {
+				t.Fatalf("circle %d allowed %s at intensity %d", circle, s.title, s.difficulty)
+			}
+		}
+	}
+
+	if got := applyCircleIntensityConstraints(8, songs); len(got) != 2 {
+		t.Fatalf("circle 8 should drop low intensities, got %d songs", len(got))
+	}
+}
+
+func TestCircleFallbackWidensBandDeterministically(t *testing.T) {
+	songs := []song{
+		{title: "Three", difficulty: 3},
+		{title: "Six", difficulty: 6},
+	}
+
+	got := applyCircleIntensityConstraints(1, songs)
+	if len(got) != 1 || got[0].title != "Three" {
+		t.Fatalf("circle 1 fallback should widen to the nearest intensity, got %+v", got)
+	}
+
+	a := generateRun(99, songs, 1)
+	b := generateRun(99, songs, 1)
+	for i := range a {
+		for r := range a[i].rows {
+			for c := range a[i].rows[r] {
+				ca, cb := a[i].rows[r][c].challenge, b[i].rows[r][c].challenge
+				if (ca == nil) != (cb == nil) {
+					t.Fatalf("act %d row %d col %d differs between identical seeds", i+1, r, c)
+				}
+				if ca != nil && songKey(ca.songs[0]) != songKey(cb.songs[0]) {
+					t.Fatalf("act %d row %d col %d pools differ between identical seeds", i+1, r, c)
+				}
+			}
+		}
+	}
+}
+
+func TestCirclePickerStartsRun(t *testing.T) {
+	m := newModel([]song{
+		{title: "Easy", artist: "A", difficulty: 0},
+		{title: "Hard", artist: "B", difficulty: 6},
+	})
+	if !m.choosingCircle {
+		t.Fatalf("expected circle picker on launch")
+	}
+
+	next, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("9")})
+	next, _ = next.(model).Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = next.(model)
+	if m.choosingCircle || m.circle != 9 {
+		t.Fatalf("expected circle 9 run, got circle %d choosing %v", m.circle, m.choosingCircle)
+	}
+	for _, row := range m.acts[0].rows[:len(m.acts[0].rows)-1] {
+		for _, n := range row {
+			if n.challenge == nil {
+				continue
+			}
+			for _, s := range n.challenge.songs {
+				if s.difficulty < 5 {
+					t.Fatalf("circle 9 run offered %s at intensity %d", s.title, s.difficulty)
+				}
+			}
+		}
+	}
+}
+
+func TestSaveAndResumeRun(t *testing.T) {
+	var songs []song
+	for i := 0; i < 12; i++ {
+		songs = append(songs, song{
+			id:         string(rune('a' + i)),
+			title:      "Song " + string(rune('A'+i)),
+			artist:     "Band",
+			genre:      "Rock",
+			year:       1980 + i,
+			seconds:    200 + i*20,
+			difficulty: i % 4,
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), "save.json")
+	m := newModel(songs)
+	m.savePath = path
+	m.circle = 7
+	m.resetRun()
+
+	m.commitSelection()
+	m.selectedSongs = append([]song{}, m.selectionPool[:2]...)
+	m.startStarEntry()
+	for _, v := range []string{"6", "3"} {
+		m.starInput = v
+		m.submitStars()
+	}
+	m.confirmStars()
+	if m.saveErr != nil {
+		t.Fatalf("autosave failed: %v", m.saveErr)
+	}
+
+	save, err := readSave(path)
+	if err != nil {
+		t.Fatalf("readSave: %v", err)
+	}
+	if save.Version != saveVersion || save.Seed != m.seed || save.Voltage != m.voltage {
+		t.Fatalf("unexpected save payload: %+v", save)
+	}
+
+	resumed := newModel(songs)
+	resumed.offerResume(save)
+	resumed.resumeSaved()
+	if resumed.resumePrompt || resumed.choosingCircle {
+		t.Fatalf("expected to land on the map after resuming")
+	}
+	if resumed.seed != m.seed || resumed.circle != 7 || resumed.voltage != m.voltage {
+		t.Fatalf("resumed run mismatch: seed %d circle %d voltage %d", resumed.seed, resumed.circle, resumed.voltage)
+	}
+	if resumed.cursorRow != m.cursorRow || resumed.cursorCol != m.cursorCol {
+		t.Fatalf("cursor mismatch: got %d/%d want %d/%d", resumed.cursorRow, resumed.cursorCol, m.cursorRow, m.cursorCol)
+	}
+	run, ok := resumed.runs[0]
+	if !ok || len(run.songs) != 2 || run.stars[0] != 6 || run.stars[1] != 3 || run.passed != m.runs[0].passed {
+		t.Fatalf("row 0 results not restored: %+v", run)
+	}
+	if resumed.committed[0] != m.committed[0] {
+		t.Fatalf("committed path not restored")
+	}
+}
+
+func TestFailedResumeKeepsFreshRun(t *testing.T) {
+	songs := bossTestSongs()
+	m := newModel(songs)
+	m.circle = 7
+	m.choosingCircle = false
+	m.resetRun()
+	seed, acts, rows := m.seed, len(m.acts), len(m.acts[0].rows)
+
+	save := m.snapshot()
+	save.Seed = seed + 1
+	save.CurrentAct = 99
+	m.offerResume(save)
+	m.resumeSaved()
+	if m.saveErr == nil || !m.choosingCircle {
+		t.Fatalf("a bad save should report an error and open the circle picker")
+	}
+	next, _ := m.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	m = next.(model)
+	if m.choosingCircle || m.seed != seed || len(m.acts) != acts || len(m.acts[0].rows) != rows {
+		t.Fatalf("esc after a failed resume should return to the untouched run, got seed %d", m.seed)
+	}
+	if m.shape().Acts != standardRun.Acts || len(m.actRuns) != acts {
+		t.Fatalf("failed resume should not leave a half-restored history")
+	}
+}
+
+func TestResumeNeedsTheSameCustomChallenges(t *testing.T) {
+	songs := compoundTestSongs()
+	withCustomChallenges(t, []challengeDef{{ID: "metal", Name: "Metal", Summary: "Pick {pick} of {pool}.", Filter: `genre == "metal"`}})
+	m := newModel(songs)
+	m.circle = 7
+	m.choosingCircle = false
+	m.resetRun()
+	save := m.snapshot()
+	if save.ChallengeDefs == "" {
+		t.Fatalf("save should fingerprint the loaded definitions")
+	}
+
+	same := newModel(songs)
+	same.offerResume(save)
+	same.resumeSaved()
+	if same.saveErr != nil || same.seed != m.seed {
+		t.Fatalf("resuming with the same definitions should work: %v", same.saveErr)
+	}
+
+	withCustomChallenges(t, []challengeDef{{ID: "metal", Name: "Metal", Summary: "Pick {pick} of {pool}.", Filter: `genre == "rock"`}})
+	changed := newModel(songs)
+	changed.offerResume(save)
+	changed.resumeSaved()
+	if changed.saveErr == nil || !strings.Contains(changed.saveErr.Error(), "custom challenges") || changed.seed == m.seed {
+		t.Fatalf("resuming with edited definitions should be refused, got %v", changed.saveErr)
+	}
+}
+
+func TestReadSaveRejectsUnknownVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "save.json")
+	if err := os.WriteFile(path, []byte(`{"version": 99, "seed": 1}`), 0o644); err != nil {
+		t.Fatalf("write save: %v", err)
+	}
+	if _, err := readSave(path); err == nil {
+		t.Fatalf("expected version error")
+	}
+}
+
+type parityFixture struct {
+	Catalog []struct {
+		ID         string `json:"id"`
+		Title      string `json:"title"`
+		Artist     string `json:"artist"`
+		Album      string `json:"album"`
+		AlbumTrack int    `json:"albumTrack"`
+		Genre      string `json:"genre"`
+		Year       int    `json:"year"`
+		Seconds    int    `json:"seconds"`
+		Difficulty int    `json:"difficulty"`
+		Origin     string `json:"origin"`
+		Guitar     bool   `json:"supports_guitar"`
+		Bass       bool   `json:"supports_bass"`
+		Drums      bool   `json:"supports_drums"`
+		Vocals     bool   `json:"supports_vocals"`
+	} `json:"catalog"`
+	RNG []struct {
+		Seed   int64     `json:"seed"`
+		Values []float64 `json:"values"`
+	} `json:"rng"`
+	Runs []struct {
+		Seed int64 `json:"seed"`
+		Acts []struct {
+			Index int `json:"index"`
+			Rows  [][]struct {
+				Col         int      `json:"col"`
+				Kind        string   `json:"kind"`
+				Edges       []int    `json:"edges"`
+				SelectCount int      `json:"selectCount"`
+				Songs       []string `json:"songs"`
+			} `json:"rows"`
+		} `json:"acts"`
+	} `json:"runs"`
+}
+
+func loadParityFixture(t *testing.T) parityFixture {
+	t.Helper()
+	_, filename, _, _ := runtime.Caller(0)
+	path := filepath.Join(filepath.Dir(filename), "..", "..", "testdata", "parity", "generator.json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read parity fixture: %v", err)
+	}
+	var fx parityFixture
+	if err := json.Unmarshal(data, &fx); err != nil {
+		t.Fatalf("decode parity fixture: %v", err)
+	}
+	return fx
+}
+
+func TestMulberry32MatchesWebPRNG(t *testing.T) {
+	fx := loadParityFixture(t)
+	for _, tc := range fx.RNG {
+		rng := newMulberry32(tc.Seed)
+		for i, want := range tc.Values {
+			if got := rng.Float64(); got != want {
+				t.Fatalf("seed %d draw %d: got %v want %v", tc.Seed, i, got, want)
+			}
+		}
+	}
+}
+
+func TestGenerateRunMatchesWebGenerator(t *testing.T) {
+	fx := loadParityFixture(t)
+	songs := make([]song, len(fx.Catalog))
+	for i, c := range fx.Catalog {
+		songs[i] = song{id: c.ID, title: c.Title, artist: c.Artist, album: c.Album, albumTrack: c.AlbumTrack, genre: c.Genre, year: c.Year, seconds: c.Seconds, difficulty: c.Difficulty, origin: c.Origin,
+			supportsGuitar: c.Guitar, supportsBass: c.Bass, supportsDrums: c.Drums, supportsVocals: c.Vocals}
+	}
+	// elites, rests and events are placed on TUI-only streams over regular challenge nodes
+	kinds := map[nodeKind]string{nodeChallenge: "challenge", nodeElite: "challenge", nodeRest: "challenge", nodeUnknown: "challenge", nodeShop: "shop", nodeBoss: "boss"}
+
+	for _, run := range fx.Runs {
+		acts := generateRun(run.Seed, songs, 7)
+		if len(acts) != len(run.Acts) {
+			t.Fatalf("seed %d: %d acts, want %d", run.Seed, len(acts), len(run.Acts))
+		}
+		for a, wantAct := range run.Acts {
+			gotAct := acts[a]
+			if len(gotAct.rows) != len(wantAct.Rows) {
+				t.Fatalf("seed %d act %d: %d rows, want %d", run.Seed, wantAct.Index, len(gotAct.rows), len(wantAct.Rows))
+			}
+			for r, wantRow := range wantAct.Rows {
+				if len(gotAct.rows[r]) != len(wantRow) {
+					t.Fatalf("seed %d act %d row %d: %d nodes, want %d", run.Seed, wantAct.Index, r, len(gotAct.rows[r]), len(wantRow))
+				}
+				for c, want := range wantRow {
+					got := gotAct.rows[r][c]
+					where := fmt.Sprintf("seed %d act %d row %d col %d", run.Seed, wantAct.Index, r, c)
+					if kinds[got.kind] != want.Kind {
+						t.Fatalf("%s: kind %s, want %s", where, kinds[got.kind], want.Kind)
+					}
+					if fmt.Sprint(got.edges) != fmt.Sprint(want.Edges) {
+						t.Fatalf("%s: edges %v, want %v", where, got.edges, want.Edges)
+					}
+					if got.kind == nodeBoss || got.kind == nodeElite || got.kind == nodeRest || got.kind == nodeUnknown {
+						// bosses, elites, rests and events are TUI-only (see boss.go, elite.go, rest.go, event.go)
+						continue
+					}
+					var ids []string
+					selectCount := 0
+					if got.challenge != nil {
+						selectCount = got.challenge.selectCount
+						for _, s := range got.challenge.songs {
+							ids = append(ids, s.id)
+						}
+					}
+					if selectCount != want.SelectCount {
+						t.Fatalf("%s: selectCount %d, want %d", where, selectCount, want.SelectCount)
+					}
+					if strings.Join(ids, ",") != strings.Join(want.Songs, ",") {
+						t.Fatalf("%s: songs %v, want %v", where, ids, want.Songs)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestOriginGroupsAndFiltering(t *testing.T) {
+	sources := map[string]sourceInfo{
+		"Rock Band 2":     {source: "Rock Band 2", series: "Rock Band", included: true},
+		"Rock Band 2 DLC": {source: "Rock Band 2 DLC", series: "Rock Band", included: true},
+		"Guitar Hero II":  {source: "Guitar Hero II", series: "Guitar Hero", included: true},
+		"Archived Charts": {source: "Archived Charts", series: "customs", included: false},
+	}
+	songs := []song{
+		{id: "a", title: "A", origin: "Rock Band 2"},
+		{id: "b", title: "B", origin: "Rock Band 2 DLC"},
+		{id: "c", title: "C", origin: "Guitar Hero II"},
+		{id: "d", title: "D", origin: "Archived Charts"},
+		{id: "e", title: "E", origin: "Mystery Pack"},
+		{id: "f", title: "F"},
+	}
+
+	groups := collectOriginGroups(songs, sources)
+	var names []string
+	for _, g := range groups {
+		names = append(names, g.series+":"+strings.Join(g.origins, "|"))
+	}
+	want := "Guitar Hero:Guitar Hero II,Other:Mystery Pack,Rock Band:Rock Band 2|Rock Band 2 DLC"
+	if strings.Join(names, ",") != want {
+		t.Fatalf("unexpected groups: %v", names)
+	}
+
+	all := filterSongsByOrigin(songs, sources, nil)
+	if len(all) != 5 {
+		t.Fatalf("expected excluded source to be dropped, got %d songs", len(all))
+	}
+
+	rb := filterSongsByOrigin(songs, sources, map[string]bool{"Rock Band 2 DLC": true})
+	var ids []string
+	for _, s := range rb {
+		ids = append(ids, s.id)
+	}
+	if strings.Join(ids, ",") != "b,f" {
+		t.Fatalf("expected DLC plus origin-less songs, got %v", ids)
+	}
+}
+
+func TestOriginPickerPersistsSelectionAcrossRuns(t *testing.T) {
+	var songs []song
+	for i, origin := range []string{"Pack A", "Pack A", "Pack A", "Pack B", "Pack B", "Pack B"} {
+		songs = append(songs, song{
+			id:         fmt.Sprintf("s%d", i),
+			title:      fmt.Sprintf("Song %d", i),
+			artist:     "Band",
+			origin:     origin,
+			seconds:    200,
+			difficulty: 1,
+		})
+	}
+	m := newModel(songs)
+	m.chooseCircle(7)
+	if !m.choosingOrigins {
+		t.Fatalf("expected origin picker after choosing a circle")
+	}
+
+	// rows: [Other header, Pack A, Pack B]; deselect Pack B
+	m.moveOriginCursor(2)
+	m.toggleOriginRow()
+	m.confirmOrigins()
+	if m.choosingOrigins || !m.selectedOrigins["Pack A"] || m.selectedOrigins["Pack B"] {
+		t.Fatalf("unexpected selection: %v", m.selectedOrigins)
+	}
+	for _, n := range m.acts[0].rows[0] {
+		for _, s := range n.challenge.songs {
+			if s.origin != "Pack A" {
+				t.Fatalf("run offered %s from %s", s.title, s.origin)
+			}
+		}
+	}
+
+	m.resetRun()
+	if !m.selectedOrigins["Pack A"] || m.selectedOrigins["Pack B"] {
+		t.Fatalf("selection should survive a reroll: %v", m.selectedOrigins)
+	}
+	m.openOriginPicker()
+	if !m.pendingOrigins["Pack A"] || m.pendingOrigins["Pack B"] {
+		t.Fatalf("picker should reopen with the saved selection: %v", m.pendingOrigins)
+	}
+
+	save := m.snapshot()
+	if strings.Join(save.SelectedOrigins, ",") != "Pack A" {
+		t.Fatalf("save should record origins, got %v", save.SelectedOrigins)
+	}
+}
+
+func TestLoadSourceInfo(t *testing.T) {
+	_, filename, _, _ := runtime.Caller(0)
+	path := filepath.Join(filepath.Dir(filename), "..", "..", "source_info.csv")
+
+	sources, err := loadSourceInfo(path)
+	if err != nil {
+		t.Fatalf("loadSourceInfo error: %v", err)
+	}
+	if info := sources["Rock Band 3 DLC"]; info.series != "Rock Band" || !info.included {
+		t.Fatalf("unexpected Rock Band 3 DLC info: %+v", info)
+	}
+	if sources["Archived Charts"].included {
+		t.Fatalf("Archived Charts should be excluded")
+	}
+}
+
+func TestLoadSongsReadsJSONCatalog(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "catalog.json")
+	contents := `[
+  {"id": "id-1", "title": "Song One", "artist": "Artist", "album": "Album", "genre": "Rock",
+   "diff_band": "4", "diff_drums": "5", "diff_guitar_coop": "-1", "origin": "Rock Band 2",
+   "series": "Rock Band", "length": "06:00", "seconds": 360, "year": 2000, "album_track": "7",
+   "source_included": true, "supports_guitar": true, "supports_bass": false,
+   "supports_drums": true, "supports_vocals": true},
+  {"id": "id-2", "title": "Song Two", "artist": "Artist", "difficulty": "2", "seconds": null,
+   "length": "2:05", "source_included": false}
+]`
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatalf("write temp json: %v", err)
+	}
+
+	songs, err := loadSongs(path)
+	if err != nil {
+		t.Fatalf("loadSongs error: %v", err)
+	}
+	if len(songs) != 2 {
+		t.Fatalf("expected 2 songs, got %d", len(songs))
+	}
+	first := songs[0]
+	if first.difficulty != 4 || first.diffDrums != 5 || first.diffCoop != -1 {
+		t.Fatalf("difficulties not parsed: %+v", first)
+	}
+	if first.seconds != 360 || first.year != 2000 || first.series != "Rock Band" || first.albumTrack != 7 {
+		t.Fatalf("numeric/series fields not parsed: %+v", first)
+	}
+	if first.excluded || !first.supportsGuitar || first.supportsBass || !first.supportsDrums {
+		t.Fatalf("flags not parsed: %+v", first)
+	}
+
+	second := songs[1]
+	if second.difficulty != 2 {
+		t.Fatalf("expected difficulty fallback, got %d", second.difficulty)
+	}
+	if second.seconds != 125 {
+		t.Fatalf("expected seconds from length, got %d", second.seconds)
+	}
+	if !second.excluded {
+		t.Fatalf("expected source_included=false to mark the song excluded")
+	}
+	if got := filterSongsByOrigin(songs, nil, nil); len(got) != 1 {
+		t.Fatalf("excluded songs should not reach runs, got %d", len(got))
+	}
+}
+
+func TestJSONAndCSVCatalogsAgree(t *testing.T) {
+	_, filename, _, _ := runtime.Caller(0)
+	root := filepath.Join(filepath.Dir(filename), "..", "..")
+
+	fromJSON, err := loadSongs(filepath.Join(root, "downloaded_songs.json"))
+	if err != nil {
+		t.Fatalf("load json: %v", err)
+	}
+	fromCSV, err := loadSongs(filepath.Join(root, "downloaded_songs.csv"))
+	if err != nil {
+		t.Fatalf("load csv: %v", err)
+	}
+	byID := make(map[string]song, len(fromCSV))
+	for _, s := range fromCSV {
+		byID[s.id] = s
+	}
+	shared := 0
+	for _, j := range fromJSON {
+		c, ok := byID[j.id]
+		if !ok {
+			continue
+		}
+		shared++
+		if j.title != c.title || j.difficulty != c.difficulty || j.seconds != c.seconds || j.year != c.year {
+			t.Fatalf("song %s differs: json %+v csv %+v", j.id, j, c)
+		}
+	}
+	if shared < len(fromCSV)/2 {
+		t.Fatalf("expected the catalogs to overlap, only %d shared songs", shared)
+	}
+}
+
+func TestValidateCatalogReportsEveryProblem(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "catalog.csv")
+	contents := "id,title,artist,album,genre,length,seconds,year,diff_band,diff_drums,supports_drums,length,seconds\n" +
+		"a,Song A,Band,Album,Rock,3:00,180,1990,2,3,true,3:00,180\n" +
+		",Song B,Band,Album,Rock,3:10,190,1991,2,3,true,3:10,190\n" +
+		"a,Song C,Band,Album,Rock,3:20,200,1992,2,3,true,3:20,200\n" +
+		"d,song a,BAND,Album,Rock,3:00,180,1990,2,3,true,3:00,180\n" +
+		"e,Song E,Band,Album,Rock,three,abc,19x0,-1,-1,true,3:00,180\n" +
+		"f,Song F,Band,Album,Rock,4:00,240,1993,3,2,true,4:01,241\n"
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatalf("write temp csv: %v", err)
+	}
+
+	records, err := readCatalogRecords(path)
+	if err != nil {
+		t.Fatalf("readCatalogRecords error: %v", err)
+	}
+	report := validateCatalog(path, records)
+
+	found := map[string]bool{}
+	for _, issue := range report.Issues {
+		found[fmt.Sprintf("%d:%s:%s", issue.Row, issue.Code, issue.Field)] = true
+	}
+	for _, want := range []string{
+		"3:missing-id:id",
+		"4:duplicate-id:id",
+		"5:duplicate-song:title",
+		"6:bad-length:length",
+		"6:bad-number:seconds",
+		"6:bad-number:year",
+		"6:unrated-difficulty:diff_band",
+		"6:unrated-difficulty:diff_drums",
+		"7:conflicting-column:length",
+		"7:conflicting-column:seconds",
+	} {
+		if !found[want] {
+			t.Fatalf("expected issue %s in report: %+v", want, report.Issues)
+		}
+	}
+	if report.Songs != 6 || report.Errors == 0 || report.Warnings == 0 {
+		t.Fatalf("unexpected totals: %+v", report)
+	}
+}
+
+func TestCatalogValidateCommand(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.json")
+	bad := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(good, []byte(`[{"id": "a", "title": "A", "artist": "B", "length": "3:00", "seconds": 180, "diff_band": "2"}]`), 0o644); err != nil {
+		t.Fatalf("write good catalog: %v", err)
+	}
+	if err := os.WriteFile(bad, []byte(`[{"id": "a", "title": "A", "artist": "B", "length": "3:00"}, {"id": "a", "title": "", "artist": "B", "length": "3:00"}]`), 0o644); err != nil {
+		t.Fatalf("write bad catalog: %v", err)
+	}
+
+	var out, errOut bytes.Buffer
+	if code := runCatalogCommand([]string{"validate", good}, &out, &errOut); code != 0 {
+		t.Fatalf("expected exit 0 for clean catalog, got %d: %s%s", code, out.String(), errOut.String())
+	}
+	if !strings.Contains(out.String(), "1 songs, 0 errors") {
+		t.Fatalf("unexpected text report: %s", out.String())
+	}
+
+	out.Reset()
+	if code := runCatalogCommand([]string{"validate", "--format", "json", bad}, &out, &errOut); code != 1 {
+		t.Fatalf("expected exit 1 for catalog with errors, got %d", code)
+	}
+	var report catalogReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("json report did not decode: %v\n%s", err, out.String())
+	}
+	if report.Errors != 2 || report.Issues[1].Code != "duplicate-id" || report.Issues[1].Row != 2 {
+		t.Fatalf("unexpected json report: %+v", report)
+	}
+
+	if code := runCatalogCommand([]string{"lint"}, &out, &errOut); code != 2 {
+		t.Fatalf("expected usage exit code for unknown subcommand, got %d", code)
+	}
+}
+
+func TestSongsForInstrumentUsesPartTier(t *testing.T) {
+	songs := []song{
+		{id: "a", title: "A", difficulty: 1, diffDrums: 6, diffVocals: 2},
+		{id: "b", title: "B", difficulty: 5, diffDrums: 1, diffVocals: -1},
+		{id: "c", title: "C", difficulty: 3, diffDrums: -1, diffVocals: 4},
+	}
+
+	drums := songsForInstrument(songs, instrumentDrums)
+	if len(drums) != 2 || drums[0].difficulty != 6 || drums[1].difficulty != 1 {
+		t.Fatalf("drum tiers not applied: %+v", drums)
+	}
+	if songs[0].difficulty != 1 {
+		t.Fatalf("re-tiering should not mutate the catalog")
+	}
+
+	vocals := songsForInstrument(songs, instrumentVocals)
+	for _, s := range vocals {
+		if s.id == "b" {
+			t.Fatalf("song without a vocal part should be excluded")
+		}
+	}
+
+	// act 1 allows <= 3: with drums, A (drums 6) is out and B (drums 1) is in
+	act1 := applyActDifficultyConstraints(1, drums)
+	if len(act1) != 1 || act1[0].id != "b" {
+		t.Fatalf("act gating should use the drum tier, got %+v", act1)
+	}
+
+	if got := songsForInstrument(songs[2:], instrumentDrums); len(got) != 1 || got[0].difficulty != 3 {
+		t.Fatalf("expected band fallback when no song has the part, got %+v", got)
+	}
+}
+
+func TestInstrumentRunFiltersAndPreview(t *testing.T) {
+	var songs []song
+	for i := 0; i < 12; i++ {
+		drums := i % 7
+		if i%4 == 0 {
+			drums = -1
+		}
+		songs = append(songs, song{
+			id:         fmt.Sprintf("s%d", i),
+			title:      fmt.Sprintf("Song %d", i),
+			artist:     "Band",
+			seconds:    200,
+			difficulty: 6 - i%7,
+			diffDrums:  drums,
+		})
+	}
+	m := newModel(songs)
+	m.instrumentPick = cycleInstrument(instrumentBand, 3)
+	if m.instrumentPick != instrumentDrums {
+		t.Fatalf("expected drums, got %s", m.instrumentPick)
+	}
+	m.chooseCircle(7)
+	if m.instrument != instrumentDrums {
+		t.Fatalf("choosing a circle should apply the picked instrument, got %s", m.instrument)
+	}
+
+	for _, a := range m.acts {
+		for _, row := range a.rows[:len(a.rows)-1] {
+			for _, n := range row {
+				if n.challenge == nil {
+					continue
+				}
+				for _, s := range n.challenge.songs {
+					if s.diffDrums < 0 {
+						t.Fatalf("song %s has no drum part", s.title)
+					}
+					if s.difficulty != s.diffDrums {
+						t.Fatalf("song %s not tiered by drums: %d vs %d", s.title, s.difficulty, s.diffDrums)
+					}
+				}
+			}
+		}
+	}
+
+	n := m.acts[0].rows[0][0]
+	m.commitSelection()
+	out := renderNodePreview(&n, &m)
+	if strings.Contains(out, "diff ") {
+		t.Fatalf("preview should use the instrument label: %s", out)
+	}
+	if save := m.snapshot(); save.Instrument != "drums" {
+		t.Fatalf("instrument not saved: %q", save.Instrument)
+	}
+}
+
+func TestCirclePickerEscKeepsInstrument(t *testing.T) {
+	m := newModel(bossTestSongs())
+	m.chooseCircle(7)
+	seed := m.seed
+	m.openCirclePicker()
+	for _, msg := range []tea.KeyMsg{
+		{Type: tea.KeyRight},
+		{Type: tea.KeyRight},
+		{Type: tea.KeyEsc},
+	} {
+		next, _ := m.Update(msg)
+		m = next.(model)
+	}
+	if m.instrument != instrumentBand || m.seed != seed {
+		t.Fatalf("esc should discard the instrument change, got %s", m.instrument)
+	}
+	m.openCirclePicker()
+	if m.instrumentPick != instrumentBand {
+		t.Fatalf("reopening the picker should show the run's instrument, got %s", m.instrumentPick)
+	}
+}
+
+func TestShopInventoryIsDeterministicBySeed(t *testing.T) {
+	for _, seed := range []int64{1, 42, 1234567} {
+		for act := 1; act <= totalActs; act++ {
+			first := shopInventory(seed, act, 3)
+			second := shopInventory(seed, act, 3)
+			if fmt.Sprint(first) != fmt.Sprint(second) {
+				t.Fatalf("seed %d act %d inventory not stable: %v vs %v", seed, act, first, second)
+			}
+			if len(first) != shopOfferCount {
+				t.Fatalf("expected %d offers, got %d", shopOfferCount, len(first))
+			}
+			seen := map[shopItemKind]bool{}
+			for _, item := range first {
+				if seen[item.def.kind] {
+					t.Fatalf("duplicate offer %q in one shop", item.def.name)
+				}
+				seen[item.def.kind] = true
+			}
+		}
+	}
+
+	varied := false
+	base := fmt.Sprint(shopInventory(7, 1, 2))
+	for seed := int64(8); seed < 40 && !varied; seed++ {
+		varied = fmt.Sprint(shopInventory(seed, 1, 2)) != base
+	}
+	if !varied {
+		t.Fatalf("expected inventories to vary with the seed")
+	}
+}
+
+func TestShopPricingScalesByAct(t *testing.T) {
+	for _, def := range shopCatalog {
+		for act := 1; act <= totalActs; act++ {
+			scaled := float64(def.basePrice) * (1 + 0.5*float64(act-1))
+			for seed := int64(0); seed < 50; seed++ {
+				price := shopPrice(def, act, newMulberry32(seed))
+				if price%5 != 0 {
+					t.Fatalf("%s price %d not rounded to 5", def.name, price)
+				}
+				if float64(price) < scaled*0.8-2.5 || float64(price) > scaled*1.2+2.5 {
+					t.Fatalf("%s act %d price %d outside ±20%% of %.0f", def.name, act, price, scaled)
+				}
+			}
+		}
+	}
+	if got := currencyForStars([]int{6, 3, 9}); got != 150 {
+		t.Fatalf("expected stars to pay 150, got %d", got)
+	}
+}
+
+func TestShopPurchasesApplyToRun(t *testing.T) {
+	songs := []song{
+		{id: "a", title: "A", artist: "X", difficulty: 1},
+		{id: "b", title: "B", artist: "X", difficulty: 1},
+		{id: "c", title: "C", artist: "X", difficulty: 1},
+		{id: "d", title: "D", artist: "X", difficulty: 1},
+	}
+	a := act{
+		index: 1,
+		rows: [][]node{
+			{{col: 0, kind: nodeShop, edges: []int{0}}},
+			{{col: 0, kind: nodeChallenge, edges: []int{0}, challenge: &challenge{songs: songs, selectCount: 3}}},
+			{{col: 0, kind: nodeBoss}},
+		},
+	}
+	m := model{
+		acts:      []act{a},
+		allowed:   []int{0},
+		committed: map[int]int{},
+		runs:      map[int]nodeRun{},
+		voltage:   4000,
+		currency:  1000,
+		seed:      99,
+	}
+
+	m.commitSelection()
+	if !m.shopping || len(m.shopItems) != shopOfferCount {
+		t.Fatalf("expected shop to open with offers, got %+v", m.shopItems)
+	}
+	// swap in a known inventory so the test does not depend on the draw
+	m.shopItems = []shopItem{
+		{def: shopCatalog[itemVoltageSmall], price: 60},
+		{def: shopCatalog[itemExtraSlot], price: 80},
+		{def: shopCatalog[itemReroll], price: 2000},
+	}
+	m.buyShopItem()
+	m.buyShopItem()
+	if m.voltage != 6000 || m.currency != 940 {
+		t.Fatalf("expected one refill: voltage %d currency %d", m.voltage, m.currency)
+	}
+	m.moveShopCursor(1)
+	m.buyShopItem()
+	m.moveShopCursor(1)
+	m.buyShopItem()
+	if m.extraSlots != 1 || m.rerolls != 0 || m.currency != 860 {
+		t.Fatalf("unexpected tokens after purchases: slots %d rerolls %d currency %d", m.extraSlots, m.rerolls, m.currency)
+	}
+	if !strings.Contains(m.shopMessage, "Not enough cash") {
+		t.Fatalf("expected a refusal for the unaffordable item, got %q", m.shopMessage)
+	}
+
+	m.leaveShop()
+	if m.shopping || m.cursorRow != 1 {
+		t.Fatalf("leaving the shop should advance a row, got row %d", m.cursorRow)
+	}
+
+	m.commitSelection()
+	for range songs {
+		m.toggleSongSelection()
+		m.moveSongSelection(1)
+	}
+	m.confirmSelection()
+	if !m.enteringStars || len(m.selectedSongs) != 4 {
+		t.Fatalf("encore slot should allow a fourth song, got %d", len(m.selectedSongs))
+	}
+	for _, v := range []string{"6", "6", "6", "0"} {
+		m.starInput = v
+		m.submitStars()
+	}
+	m.confirmStars()
+	if m.voltage != 6000 || m.extraSlots != 0 {
+		t.Fatalf("lowest result should be dropped: voltage %d slots %d", m.voltage, m.extraSlots)
+	}
+	if m.currency != 860+180 {
+		t.Fatalf("expected stars to pay out, got %d", m.currency)
+	}
+}
+
+func TestRerollTokenRedrawsChallengePool(t *testing.T) {
+	var songs []song
+	for i := 0; i < 40; i++ {
+		songs = append(songs, song{
+			id:         fmt.Sprintf("s%d", i),
+			title:      fmt.Sprintf("Song %d", i),
+			artist:     "Band",
+			genre:      []string{"Rock", "Pop", "Metal"}[i%3],
+			year:       1970 + i,
+			seconds:    150 + i*10,
+			difficulty: i % 4,
+		})
+	}
+	m := newModel(songs)
+	m.circle = 7
+	m.resetRun()
+	m.rerolls = 1
+
+	m.commitSelection()
+	m.rerollSelectionPool()
+	if m.rerolls != 0 || len(m.selectionPool) == 0 {
+		t.Fatalf("expected the token to be spent on a fresh pool")
+	}
+	if got := fmt.Sprint(m.selectedNode().challenge.songs); got != fmt.Sprint(m.selectionPool) {
+		t.Fatalf("node challenge should match the rerolled pool")
+	}
+	after := fmt.Sprint(m.selectionPool)
+	m.rerollSelectionPool()
+	if fmt.Sprint(m.selectionPool) != after {
+		t.Fatalf("reroll without a token should not change the pool")
+	}
+}
+
+func TestRerollsDrawOnlyUnorderedBuiltIns(t *testing.T) {
+	songs := albumTestSongs()
+	ordered := false
+	for seed := int64(0); seed < 200; seed++ {
+		if newChallenge(3, songs, newMulberry32(seed), 6, 2, nil).ordered {
+			ordered = true
+		}
+		if c := newUnorderedChallenge(3, songs, newMulberry32(seed), 6, 2); c.ordered {
+			t.Fatalf("seed %d: a reroll drew an ordered %s", seed, c.name)
+		}
+	}
+	if !ordered {
+		t.Fatalf("the catalog should allow ordered challenges for this test to mean anything")
+	}
+
+	withCustomChallenges(t, []challengeDef{{ID: "all", Name: "All", Summary: "Pick {pick} of {pool}.", Weights: map[int]float64{3: 1000}}})
+	for seed := int64(0); seed < 50; seed++ {
+		if c := newUnorderedChallenge(3, songs, newMulberry32(seed), 6, 2); c.kind == challengeCustom {
+			t.Fatalf("seed %d: a reroll drew custom challenge %s", seed, c.id)
+		}
+	}
+}
+
+func TestRerollSurvivesResume(t *testing.T) {
+	songs := compoundTestSongs()
+	path := filepath.Join(t.TempDir(), "save.json")
+	m := newModel(songs)
+	m.savePath = path
+	m.circle = 7
+	m.choosingCircle = false
+	m.resetRun()
+	m.rerolls = 2
+	m.commitSelection()
+	m.rerollSelectionPool()
+	m.rerollSelectionPool()
+
+	save, err := readSave(path)
+	if err != nil {
+		t.Fatalf("a reroll should autosave: %v", err)
+	}
+	if save.Rerolls != 0 || save.RerollCount != 2 || len(save.Redraws) != 2 {
+		t.Fatalf("save should record spent tokens and draws: %+v", save)
+	}
+	resumed := newModel(songs)
+	resumed.offerResume(save)
+	resumed.resumeSaved()
+	if resumed.saveErr != nil || resumed.rerollCount != 2 {
+		t.Fatalf("resume should keep the reroll count: %v %d", resumed.saveErr, resumed.rerollCount)
+	}
+	got := resumed.acts[0].rows[m.cursorRow][m.cursorCol].challenge
+	if fmt.Sprint(got.songs) != fmt.Sprint(m.selectionPool) {
+		t.Fatalf("resumed node should keep the rerolled pool\n got %v\nwant %v", got.songs, m.selectionPool)
+	}
+
+	m.starInput = ""
+	m.selectedSongs = append([]song{}, m.selectionPool[:m.requiredSelection()]...)
+	m.startStarEntry()
+	for range m.selectedSongs {
+		m.starInput = "6"
+		m.submitStars()
+	}
+	m.confirmStars()
+	if save := m.snapshot(); len(save.Redraws) != 0 || save.RerollCount != 2 {
+		t.Fatalf("draws on a finished row should not be saved: %+v", save.Redraws)
+	}
+}
+
+func bossTestSongs() []song {
+	var songs []song
+	for i := 0; i < 30; i++ {
+		songs = append(songs, song{
+			id:         fmt.Sprintf("b%d", i),
+			title:      fmt.Sprintf("Boss Song %d", i),
+			artist:     []string{"Queen", "Rush", "Heart", "Yes", "Toto"}[i%5],
+			genre:      "Rock",
+			year:       1970 + i,
+			seconds:    180 + i*15,
+			difficulty: i % 7,
+		})
+	}
+	return songs
+}
+
+func TestBossesComeFromActRosterBySeed(t *testing.T) {
+	songs := bossTestSongs()
+	seen := map[string]bool{}
+	for seed := int64(0); seed < 40; seed++ {
+		first := generateRun(seed, songs, 7)
+		second := generateRun(seed, songs, 7)
+		for a := range first {
+			boss := first[a].rows[rowsPerAct-1][0].challenge
+			again := second[a].rows[rowsPerAct-1][0].challenge
+			if boss.id != again.id || fmt.Sprint(boss.songs) != fmt.Sprint(again.songs) {
+				t.Fatalf("seed %d act %d boss not stable", seed, a+1)
+			}
+			allowed := false
+			for _, kind := range rosterForAct(first[a].index) {
+				allowed = allowed || kind == boss.boss.kind
+			}
+			if !allowed {
+				t.Fatalf("act %d rolled %s outside its roster", first[a].index, boss.id)
+			}
+			actSongs := map[string]bool{}
+			for _, s := range applyActDifficultyConstraints(first[a].index, songs) {
+				actSongs[s.id] = true
+			}
+			for _, s := range boss.songs {
+				if !actSongs[s.id] {
+					t.Fatalf("act %d boss song %s is outside the act catalog", first[a].index, s.id)
+				}
+			}
+			if boss.boss.kind == bossMedley {
+				for _, s := range boss.songs {
+					if s.artist != boss.songs[0].artist {
+						t.Fatalf("medley mixes artists: %v", boss.songs)
+					}
+				}
+			}
+			seen[boss.id] = true
+		}
+	}
+	for _, id := range []string{"boss-anthem", "boss-medley", "boss-setlist"} {
+		if !seen[id] {
+			t.Fatalf("expected %s to appear across seeds, saw %v", id, seen)
+		}
+	}
+}
+
+func TestBossRuleWinConditions(t *testing.T) {
+	anthem := bossRule{kind: bossAnthem, minEach: 5}
+	if !anthem.met([]int{5}) || anthem.met([]int{4}) {
+		t.Fatalf("anthem should need 5 stars")
+	}
+	medley := bossRule{kind: bossMedley, minEach: 3}
+	if !medley.met([]int{3, 6, 4}) || medley.met([]int{6, 6, 2}) {
+		t.Fatalf("medley should need every song at 3 stars")
+	}
+	setlist := bossRule{kind: bossSetlist, minTotal: 12}
+	if !setlist.met([]int{6, 6, 0}) || setlist.met([]int{4, 4, 3}) {
+		t.Fatalf("setlist should need 12 stars in total")
+	}
+	if setlist.met(nil) {
+		t.Fatalf("no results should never beat a boss")
+	}
+}
+
+func TestBossPreviewTeasesUntilCommitted(t *testing.T) {
+	m := newModel(bossTestSongs())
+	m.circle = 7
+	m.resetRun()
+	m.cursorRow = rowsPerAct - 1
+	m.allowed = []int{0}
+	m.cursorCol = 0
+
+	boss := m.selectedNode().challenge
+	preview := renderNodePreview(m.selectedNode(), &m)
+	if !strings.Contains(preview, "Boss: "+boss.name) || !strings.Contains(preview, "Win:") {
+		t.Fatalf("expected boss name and win condition in preview:\n%s", preview)
+	}
+	for _, s := range boss.songs {
+		if strings.Contains(preview, s.title) {
+			t.Fatalf("preview revealed boss song %q:\n%s", s.title, preview)
+		}
+	}
+
+	m.commitSelection()
+	if !m.enteringStars || len(m.selectedSongs) != len(boss.songs) {
+		t.Fatalf("boss should skip song selection")
+	}
+	for range boss.songs {
+		m.starInput = "6"
+		m.submitStars()
+	}
+	m.confirmStars()
+	if m.currentAct != 1 {
+		t.Fatalf("resolving the boss should move on to act 2, on act %d", m.currentAct+1)
+	}
+	m.prevAct()
+	m.browseRow(rowsPerAct)
+	if preview := renderNodePreview(m.selectedNode(), &m); !strings.Contains(preview, "Boss defeated!") {
+		t.Fatalf("expected a defeated boss:\n%s", preview)
+	}
+}
+
+func TestChallengeGoalsResolvePassAndFail(t *testing.T) {
+	if actGoal(1) != 3 || actGoal(2) != 4 || actGoal(3) != 5 {
+		t.Fatalf("unexpected act goals %d/%d/%d", actGoal(1), actGoal(2), actGoal(3))
+	}
+	if got := goalVoltageLoss(4, []int{3, 2}); got != 2000 {
+		t.Fatalf("average 2.5 vs 4★ should cost 2000, got %d", got)
+	}
+	if got := goalVoltageLoss(3, []int{3, 6}); got != 0 {
+		t.Fatalf("meeting the goal should cost nothing, got %d", got)
+	}
+	if !meetsGoal(3, []int{2, 4}) || meetsGoal(5, []int{6, 3}) {
+		t.Fatalf("meetsGoal should compare the average")
+	}
+
+	for _, tc := range []struct {
+		name    string
+		stars   []string
+		passed  bool
+		voltage int
+		cash    int
+		outcome string
+	}{
+		{"pass", []string{"4", "3"}, true, startingVoltage, 70 + goalBonus, "Goal met"},
+		{"fail", []string{"1", "2"}, false, startingVoltage - 2000, 30, "Goal missed"},
+	} {
+		songs := []song{
+			{id: "a", title: "A", artist: "X", difficulty: 1},
+			{id: "b", title: "B", artist: "X", difficulty: 1},
+		}
+		a := act{
+			index: 1,
+			rows: [][]node{
+				{{col: 0, kind: nodeChallenge, edges: []int{0}, challenge: &challenge{songs: songs, selectCount: 2, goal: 3}}},
+				{{col: 0, kind: nodeBoss}},
+			},
+		}
+		m := model{
+			acts:      []act{a},
+			allowed:   []int{0},
+			committed: map[int]int{},
+			runs:      map[int]nodeRun{},
+			voltage:   startingVoltage,
+		}
+		if preview := renderNodePreview(m.selectedNode(), &m); !strings.Contains(preview, "Goal: average 3★") {
+			t.Fatalf("%s: preview should show the goal:\n%s", tc.name, preview)
+		}
+		m.commitSelection()
+		m.selectedSongs = songs
+		m.startStarEntry()
+		for _, v := range tc.stars {
+			m.starInput = v
+			m.submitStars()
+		}
+		m.confirmStars()
+		if m.runs[0].passed != tc.passed || m.voltage != tc.voltage || m.currency != tc.cash {
+			t.Fatalf("%s: passed %v voltage %d cash %d", tc.name, m.runs[0].passed, m.voltage, m.currency)
+		}
+		m.cursorRow = 0
+		if preview := renderNodePreview(m.selectedNode(), &m); !strings.Contains(preview, tc.outcome) {
+			t.Fatalf("%s: expected %q in preview:\n%s", tc.name, tc.outcome, preview)
+		}
+	}
+}
+
+func TestLengthChallengesUseWebThresholds(t *testing.T) {
+	lengths := []int{0, 120, 150, 151, 240, 299, 300, 301, 419, 420, 600}
+	var songs []song
+	for i, secs := range lengths {
+		songs = append(songs, song{id: fmt.Sprintf("l%d", i), title: fmt.Sprintf("Len %d", secs), seconds: secs})
+	}
+
+	for _, tc := range []struct {
+		name   string
+		create challengeCreator
+		want   []int
+	}{
+		{"ShortSongChallenge", newShortSongChallenge, []int{120, 150}},
+		{"MediumSongChallenge", newMediumSongChallenge, []int{151, 240, 299}},
+		{"EpicSongChallenge", newEpicSongChallenge, []int{420, 600}},
+		{"LongSongChallenge", newLongSongChallenge, []int{301, 419, 420, 600}},
+	} {
+		// pad the band so it clears the three-song minimum
+		pool := append([]song{}, songs...)
+		for i := 0; i < 3; i++ {
+			pool = append(pool, song{id: fmt.Sprintf("%s-pad%d", tc.name, i), seconds: tc.want[0]})
+		}
+		ch, ok := tc.create(pool, newMulberry32(5), len(pool), 3)
+		if !ok || ch.name != tc.name {
+			t.Fatalf("%s: expected a challenge, got %+v", tc.name, ch)
+		}
+		allowed := map[int]bool{}
+		for _, secs := range tc.want {
+			allowed[secs] = true
+		}
+		for _, s := range ch.songs {
+			if !allowed[s.seconds] {
+				t.Fatalf("%s: %d seconds should not qualify", tc.name, s.seconds)
+			}
+		}
+		if _, ok := tc.create(songs[:3], newMulberry32(5), 3, 3); ok {
+			t.Fatalf("%s: should refuse a catalog with fewer than three matches", tc.name)
+		}
+	}
+}
+
+func TestSelectionCountComesFromChallenge(t *testing.T) {
+	songs := []song{
+		{id: "a", title: "A", artist: "X"},
+		{id: "b", title: "B", artist: "X"},
+		{id: "c", title: "C", artist: "X"},
+		{id: "d", title: "D", artist: "X"},
+	}
+	a := act{
+		index: 1,
+		rows: [][]node{
+			{{col: 0, kind: nodeChallenge, edges: []int{0}, challenge: &challenge{
+				songs:       songs,
+				selectCount: 2,
+				summary:     pickSummary(2, len(songs), "from the 1980s"),
+			}}},
+			{{col: 0, kind: nodeBoss}},
+		},
+	}
+	m := model{
+		acts:      []act{a},
+		allowed:   []int{0},
+		committed: map[int]int{},
+		runs:      map[int]nodeRun{},
+		voltage:   startingVoltage,
+	}
+	if preview := renderNodePreview(m.selectedNode(), &m); !strings.Contains(preview, "Pick 2 of these 4 tracks from the 1980s.") {
+		t.Fatalf("expected pick N of M summary:\n%s", preview)
+	}
+
+	m.commitSelection()
+	m.toggleSongSelection()
+	m.confirmSelection()
+	if m.enteringStars {
+		t.Fatalf("confirm should wait for the required count")
+	}
+	m.moveSongSelection(1)
+	m.toggleSongSelection()
+	if m.enteringStars {
+		t.Fatalf("reaching the count should not auto-advance")
+	}
+	m.moveSongSelection(1)
+	m.toggleSongSelection()
+	if len(m.selectedSongs) != 2 {
+		t.Fatalf("selection should cap at the challenge count, got %d", len(m.selectedSongs))
+	}
+	if preview := renderNodePreview(m.selectedNode(), &m); !strings.Contains(preview, "Selected 2 of 2") {
+		t.Fatalf("expected selection progress in preview:\n%s", preview)
+	}
+	next, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'c'}})
+	m = next.(model)
+	if !m.enteringStars || len(m.selectedStars) != 2 {
+		t.Fatalf("c should confirm the selection")
+	}
+}
+
+func TestGeneratedChallengesSummarizeSelectCount(t *testing.T) {
+	acts := generateRun(42, bossTestSongs(), 7)
+	for _, a := range acts {
+		for _, row := range a.rows {
+			for _, n := range row {
+				if n.kind != nodeChallenge {
+					continue
+				}
+				c := n.challenge
+				if c.selectCount < minSelectable || c.selectCount > maxSelectable {
+					t.Fatalf("select count %d outside %d-%d", c.selectCount, minSelectable, maxSelectable)
+				}
+				if c.selectCount >= len(c.songs) {
+					t.Fatalf("pick %d of %d leaves no choice", c.selectCount, len(c.songs))
+				}
+				want := fmt.Sprintf("Pick %d of these %d tracks", c.selectCount, len(c.songs))
+				if !strings.HasPrefix(c.summary, want) {
+					t.Fatalf("summary %q should start with %q", c.summary, want)
+				}
+			}
+		}
+	}
+	for _, tc := range [][3]int{{5, 5, 4}, {5, 9, 5}, {3, 2, 1}, {2, 1, 1}} {
+		if got := clampSelectCount(tc[0], tc[1]); got != tc[2] {
+			t.Fatalf("clampSelectCount(%d, %d) = %d, want %d", tc[0], tc[1], got, tc[2])
+		}
+	}
+}
+
+func albumTestSongs() []song {
+	var songs []song
+	for i := 1; i <= 8; i++ {
+		songs = append(songs, song{
+			id:         fmt.Sprintf("dm%d", i),
+			title:      fmt.Sprintf("Magnetic %d", i),
+			artist:     "Metallica",
+			album:      "Death Magnetic",
+			albumTrack: 9 - i, // listed in reverse to check ordering
+		})
+	}
+	songs = append(songs,
+		song{id: "x1", title: "Loner", artist: "Solo", album: "One", albumTrack: 1},
+		song{id: "x2", title: "Other", artist: "Metallica", album: "Load", albumTrack: 1},
+	)
+	return songs
+}
+
+func TestArtistAndAlbumChallenges(t *testing.T) {
+	songs := albumTestSongs()
+
+	ch, ok := newArtistChallenge(songs, newMulberry32(3), 12, 2)
+	if !ok || ch.name != "ArtistChallenge" || !strings.Contains(ch.summary, "by Metallica") {
+		t.Fatalf("expected a Metallica artist challenge, got %+v", ch)
+	}
+	for _, s := range ch.songs {
+		if s.artist != "Metallica" {
+			t.Fatalf("artist challenge included %v", s)
+		}
+	}
+
+	ch, ok = newAlbumChallenge(songs, newMulberry32(3), 4, 2)
+	if !ok || ch.name != "AlbumChallenge" || len(ch.songs) != 4 || ch.selectCount != 2 {
+		t.Fatalf("expected a 4-song album pool, got %+v", ch)
+	}
+	for _, s := range ch.songs {
+		if s.album != "Death Magnetic" {
+			t.Fatalf("album challenge included %v", s)
+		}
+	}
+
+	if _, ok := newAlbumChallenge(songs[8:], newMulberry32(3), 4, 2); ok {
+		t.Fatalf("albums with fewer than three tracks should not qualify")
+	}
+}
+
+func TestFullAlbumChallengePlaysTracksInOrder(t *testing.T) {
+	songs := albumTestSongs()
+	for seed := int64(0); seed < 20; seed++ {
+		ch, ok := newFullAlbumChallenge(songs, newMulberry32(seed), 5, 1)
+		if !ok || !ch.ordered || ch.selectCount != len(ch.songs) || len(ch.songs) != 5 {
+			t.Fatalf("seed %d: unexpected full album challenge %+v", seed, ch)
+		}
+		for i := 1; i < len(ch.songs); i++ {
+			if ch.songs[i].albumTrack != ch.songs[i-1].albumTrack+1 {
+				t.Fatalf("seed %d: tracks not consecutive in album order: %v", seed, ch.songs)
+			}
+		}
+	}
+
+	ch, _ := newFullAlbumChallenge(songs, newMulberry32(1), 5, 1)
+	a := act{
+		index: 1,
+		rows: [][]node{
+			{{col: 0, kind: nodeChallenge, edges: []int{0}, challenge: ch}},
+			{{col: 0, kind: nodeBoss}},
+		},
+	}
+	m := model{acts: []act{a}, allowed: []int{0}, committed: map[int]int{}, runs: map[int]nodeRun{}, voltage: startingVoltage}
+	m.commitSelection()
+	if !m.enteringStars || fmt.Sprint(m.selectedSongs) != fmt.Sprint(ch.songs) {
+		t.Fatalf("album runs should go straight to star entry in track order")
+	}
+}
+
+func compoundTestSongs() []song {
+	var songs []song
+	genres := []string{"Metal", "Rock", "Pop"}
+	origins := []string{"Rock Band 2", "Guitar Hero II"}
+	for i := 0; i < 90; i++ {
+		songs = append(songs, song{
+			id:             fmt.Sprintf("c%d", i),
+			title:          fmt.Sprintf("Compound %d", i),
+			artist:         fmt.Sprintf("Artist %d", i%11),
+			genre:          genres[i%3],
+			year:           1970 + (i%4)*10 + i%7,
+			seconds:        120 + (i%5)*60,
+			difficulty:     i % 7,
+			origin:         origins[i%2],
+			supportsGuitar: true,
+			supportsDrums:  i%2 == 0,
+			supportsVocals: i%3 != 0,
+		})
+	}
+	return songs
+}
+
+func TestCompoundChallengesStackPredicates(t *testing.T) {
+	songs := compoundTestSongs()
+	if _, ok := newCompoundChallenge(songs, newMulberry32(1), 9, 3, 1); ok {
+		t.Fatalf("act 1 should not roll compound challenges")
+	}
+
+	facetByID := map[string]challengeFacet{}
+	for _, f := range compoundFacets {
+		facetByID[f.id] = f
+	}
+	counts := map[int]int{}
+	for seed := int64(0); seed < 200; seed++ {
+		act := 2 + int(seed%2)
+		ch, ok := newCompoundChallenge(songs, newMulberry32(seed), 5, 3, act)
+		if !ok {
+			t.Fatalf("seed %d: expected a compound challenge", seed)
+		}
+		preds := strings.Split(strings.TrimPrefix(ch.id, "compound-"), ",")
+		counts[len(preds)]++
+		if len(preds) < 2 || len(preds) > 3 || (act == 2 && len(preds) != 2) {
+			t.Fatalf("seed %d act %d: %d predicates in %s", seed, act, len(preds), ch.id)
+		}
+		if len(ch.songs) < 3 || ch.selectCount != clampSelectCount(3, len(ch.songs)) {
+			t.Fatalf("seed %d: pool %d select %d", seed, len(ch.songs), ch.selectCount)
+		}
+		for _, pred := range preds {
+			id, key, _ := strings.Cut(pred, "=")
+			for _, s := range ch.songs {
+				found := false
+				for _, v := range facetByID[id].values(s) {
+					found = found || v == key
+				}
+				if !found {
+					t.Fatalf("seed %d: %s fails %s", seed, s.id, pred)
+				}
+			}
+		}
+		if !strings.HasPrefix(ch.summary, fmt.Sprintf("Pick %d of these %d tracks ", ch.selectCount, len(ch.songs))) || ch.name == "" {
+			t.Fatalf("seed %d: unexpected name/summary %q / %q", seed, ch.name, ch.summary)
+		}
+	}
+	if counts[3] == 0 {
+		t.Fatalf("act 3 should sometimes stack three predicates: %v", counts)
+	}
+
+	name, detail, _ := describeFacets([]facetChoice{
+		{facet: 5, key: "long"},
+		{facet: 0, key: "1980"},
+		{facet: 1, key: "metal", example: song{genre: "Metal"}},
+	})
+	if name != "80s Metal over 5 minutes" || detail != "from the 1980s, in Metal, over 5 minutes" {
+		t.Fatalf("unexpected generated text %q / %q", name, detail)
+	}
+}
+
+func compiledDefs(t *testing.T, defs []challengeDef) []challengeDef {
+	t.Helper()
+	if errs := compileChallengeDefs(defs); len(errs) > 0 {
+		t.Fatalf("compile: %v", errs)
+	}
+	return defs
+}
+
+func withCustomChallenges(t *testing.T, defs []challengeDef) {
+	t.Helper()
+	customChallenges = compiledDefs(t, defs)
+	t.Cleanup(func() { customChallenges = nil })
+}
+
+func TestParseSongFilter(t *testing.T) {
+	s := song{title: "Painkiller", genre: "Metal", year: 1990, seconds: 366, difficulty: 6, supportsDrums: true}
+	for expr, want := range map[string]bool{
+		``:                                         true,
+		`genre == "metal"`:                         true,
+		`genre ~ "met" && seconds > 360`:           true,
+		`decade == 1980 || difficulty >= 6`:        true,
+		`decade == 1980 || difficulty < 6`:         false,
+		`parts has drums && title != "Painkiller"`: false,
+		`parts has drums`:                          true,
+		`parts has bass`:                           false,
+		`title != "a || b" && genre ~ "met"`:       true,
+		`title ~ "&&" || title == "x&&y"`:          false,
+		`title == "Pain\"killer" || year > 1989`:   true,
+	} {
+		f, err := parseSongFilter(expr)
+		if err != nil {
+			t.Fatalf("%q: %v", expr, err)
+		}
+		if got := f == nil || f(s); got != want {
+			t.Fatalf("%q matched %v, want %v", expr, got, want)
+		}
+	}
+	for _, bad := range []string{`tempo > 3`, `genre > "metal"`, `year == "old"`, `genre metal`, `parts == drums`} {
+		if _, err := parseSongFilter(bad); err == nil {
+			t.Fatalf("%q should not parse", bad)
+		}
+	}
+	for bad, want := range map[string]string{
+		`title == "rock && roll`:          "unterminated string",
+		`genre == "metal" &&`:             "empty clause",
+		`|| genre == "metal"`:             "empty clause",
+		`genre == "metal" && && year > 1`: "empty clause",
+		`genre == " metal"`:               "leading or trailing spaces",
+	} {
+		if _, err := parseSongFilter(bad); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%q: expected %q error, got %v", bad, want, err)
+		}
+	}
+}
+
+func TestLoadChallengeDefsValidatesEverything(t *testing.T) {
+	defs, err := loadChallengeDefs(filepath.Join("..", "..", "docs", "challenges.example.json"))
+	if err != nil || len(defs) != 3 {
+		t.Fatalf("example definitions should load: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "challenges.json")
+	bad := `{"challenges": [
+  {"id": "a", "name": "A {nope}", "summary": "ok", "filter": "tempo > 1"},
+  {"id": "a", "name": "B", "summary": "", "groupBy": "parts", "weights": {"10": 1, "2": -1}, "goal": 9}
+]}`
+	if err := os.WriteFile(path, []byte(bad), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = loadChallengeDefs(path)
+	if err == nil {
+		t.Fatalf("expected validation errors")
+	}
+	for _, want := range []string{"unknown placeholder {nope}", "unknown field", "duplicate id", "summary is empty",
+		"cannot group by", "unknown act 10", "act 2 is negative", "goal 9"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected %q in:\n%v", want, err)
+		}
+	}
+
+	var out, errOut bytes.Buffer
+	if code := runChallengesCommand([]string{"validate", path}, &out, &errOut); code != 1 {
+		t.Fatalf("invalid file should exit 1, got %d", code)
+	}
+	if code := runChallengesCommand([]string{"validate", filepath.Join("..", "..", "docs", "challenges.example.json")}, &out, &errOut); code != 0 {
+		t.Fatalf("example should validate: %s", errOut.String())
+	}
+}
+
+func TestCustomChallengesJoinGenerationByWeight(t *testing.T) {
+	songs := compoundTestSongs()
+	defs := compiledDefs(t, []challengeDef{{
+		ID:      "by-genre",
+		Name:    "{group} Spotlight",
+		Summary: "Pick {pick} of {pool} {group} songs (act {act}, goal {goal}).",
+		Filter:  `seconds >= 180`,
+		GroupBy: "genre",
+		Weights: map[int]float64{1: 1000},
+		Goal:    2,
+	}})
+
+	c := newChallenge(1, songs, newMulberry32(9), 6, 2, defs)
+	if c.id != "custom-by-genre" || c.goal != 2 {
+		t.Fatalf("heavy act 1 weight should pick the custom challenge, got %+v", c)
+	}
+	want := fmt.Sprintf("Pick 2 of %d %s songs (act 1, goal 2).", len(c.songs), c.songs[0].genre)
+	if c.name != c.songs[0].genre+" Spotlight" || c.summary != want {
+		t.Fatalf("templates not rendered: %q / %q", c.name, c.summary)
+	}
+	for _, s := range c.songs {
+		if s.seconds < 180 || s.genre != c.songs[0].genre {
+			t.Fatalf("song %v escaped the filter or group", s)
+		}
+	}
+
+	for seed := int64(0); seed < 50; seed++ {
+		if c := newChallenge(2, songs, newMulberry32(seed), 6, 2, defs); strings.HasPrefix(c.id, "custom-") {
+			t.Fatalf("weight 0 in act 2 should never pick the custom challenge")
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "challenges.json")
+	late := `{"challenges": [{"id": "late", "name": "Late", "summary": "ok", "filter": "seconds >= 180", "weights": {"5": 1000}}]}`
+	if err := os.WriteFile(path, []byte(late), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	defs, err := loadChallengeDefs(path)
+	if err != nil {
+		t.Fatalf("weights for marathon acts should load: %v", err)
+	}
+	if c := newChallenge(5, songs, newMulberry32(9), 6, 2, defs); c.id != "custom-late" {
+		t.Fatalf("heavy act 5 weight should pick the custom challenge, got %q", c.id)
+	}
+}
+
+func TestWeightedOrderFollowsWeights(t *testing.T) {
+	weights := []int{4, 0, 1, 2}
+	first := make(map[int]int)
+	for seed := int64(0); seed < 2000; seed++ {
+		order := newMulberry32(seed).weightedOrder(weights)
+		if len(order) != 3 {
+			t.Fatalf("seed %d: zero weights must be dropped, got %v", seed, order)
+		}
+		seen := map[int]bool{}
+		for _, idx := range order {
+			if idx == 1 || seen[idx] {
+				t.Fatalf("seed %d: bad order %v", seed, order)
+			}
+			seen[idx] = true
+		}
+		first[order[0]]++
+	}
+	// expected shares are 4/7, 1/7 and 2/7
+	if first[0] < 1000 || first[0] > 1300 || first[2] < 200 || first[2] > 380 {
+		t.Fatalf("first picks do not follow weights: %v", first)
+	}
+	if got := newMulberry32(1).weightedOrder([]int{0, 0}); len(got) != 0 {
+		t.Fatalf("all-zero weights should give an empty order, got %v", got)
+	}
+}
+
+func TestChallengeWeightsShiftByAct(t *testing.T) {
+	tallies := challengeDistribution(compoundTestSongs(), 7, 60, nil)
+	share := func(act int, labels ...string) float64 {
+		n := 0
+		for _, l := range labels {
+			n += tallies[act-1].counts[l]
+		}
+		return float64(n) / float64(tallies[act-1].total)
+	}
+	if tallies[0].counts["compound"] != 0 {
+		t.Fatalf("act 1 has no compound weight, got %v", tallies[0].counts)
+	}
+	easy := []string{"short", "medium", "decade", "genre"}
+	if share(1, easy...) <= share(3, easy...) {
+		t.Fatalf("broad challenges should fade by act 3: act 1 %.2f, act 3 %.2f", share(1, easy...), share(3, easy...))
+	}
+	if share(3, "compound") <= share(2, "compound") {
+		t.Fatalf("compound challenges should grow into act 3: %v / %v", tallies[1].counts, tallies[2].counts)
+	}
+}
+
+func TestChallengeStatsCommand(t *testing.T) {
+	dir := t.TempDir()
+	catalog := filepath.Join(dir, "songs.json")
+	var entries []string
+	for i := 0; i < 30; i++ {
+		entries = append(entries, fmt.Sprintf(`{"id": "s%d", "title": "Song %d", "artist": "Band %d", "genre": "Rock", "year": %d, "seconds": %d, "diff_band": "%d"}`,
+			i, i, i%4, 1975+i, 150+i*10, i%6))
+	}
+	if err := os.WriteFile(catalog, []byte("["+strings.Join(entries, ",")+"]"), 0o644); err != nil {
+		t.Fatalf("write catalog: %v", err)
+	}
+
+	var out, errOut bytes.Buffer
+	if code := runChallengesCommand([]string{"stats", "--seeds", "5", "--catalog", catalog}, &out, &errOut); code != 0 {
+		t.Fatalf("expected exit 0, got %d: %s", code, errOut.String())
+	}
+	for _, want := range []string{"Act 1:", "Act 3:", "over 5 seeds", "weight"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("stats output missing %q:\n%s", want, out.String())
+		}
+	}
+	if code := runChallengesCommand([]string{"stats", "--seeds", "0", "--catalog", catalog}, &out, &errOut); code != 2 {
+		t.Fatalf("expected usage exit code for zero seeds, got %d", code)
+	}
+	example := filepath.Join("..", "..", "docs", "challenges.example.json")
+	if code := runChallengesCommand([]string{"stats", "--seeds", "5", "--catalog", catalog, "--challenges", example}, &out, &errOut); code != 0 {
+		t.Fatalf("expected exit 0 with custom challenges, got %d: %s", code, errOut.String())
+	}
+	if customChallenges != nil {
+		t.Fatalf("stats should not touch the loaded definitions")
+	}
+}
+
+func TestGenerationAvoidsRepeatedSongs(t *testing.T) {
+	var songs []song
+	genres := []string{"Rock", "Metal", "Pop", "Punk"}
+	for i := 0; i < 1200; i++ {
+		songs = append(songs, song{
+			id:         fmt.Sprintf("r%d", i),
+			title:      fmt.Sprintf("Track %d", i),
+			artist:     fmt.Sprintf("Band %d", i%40),
+			genre:      genres[i%4],
+			year:       1960 + i%60,
+			seconds:    100 + i%400,
+			difficulty: i % 7,
+		})
+	}
+	for _, seed := range []int64{1, 7, 99} {
+		seen := map[string]string{}
+		for _, a := range generateRun(seed, songs, 7) {
+			for r, row := range a.rows {
+				for _, n := range row {
+					if n.challenge == nil {
+						continue
+					}
+					where := fmt.Sprintf("act %d row %d col %d", a.index, r, n.col)
+					for _, s := range n.challenge.songs {
+						if prev, ok := seen[s.id]; ok {
+							t.Fatalf("seed %d: %s offered at %s and %s", seed, s.id, prev, where)
+						}
+						seen[s.id] = where
+					}
+				}
+			}
+		}
+	}
+
+	acts := generateRun(5, songs, 7)
+	marked := map[string]bool{}
+	assignBoss(&acts[0], 5, songs, marked)
+	for _, s := range acts[0].rows[len(acts[0].rows)-1][0].challenge.songs {
+		if !marked[s.id] {
+			t.Fatalf("boss song %s should be marked used", s.id)
+		}
+	}
+
+	used := map[string]bool{"r0": true, "r1": true}
+	if got := freshSongs(songs[:4], used); len(got) != 2 || got[0].id != "r2" {
+		t.Fatalf("half the catalog unused should drop repeats, got %v", got)
+	}
+	used["r2"] = true
+	if got := freshSongs(songs[:4], used); len(got) != 4 {
+		t.Fatalf("mostly used catalog should allow repeats again, got %d songs", len(got))
+	}
+}
+
+func TestPlayedSongsCannotBeReplayed(t *testing.T) {
+	songs := []song{
+		{id: "a", title: "Alpha", artist: "X"},
+		{id: "b", title: "Bravo", artist: "X"},
+		{id: "c", title: "Charlie", artist: "X"},
+	}
+	a := act{
+		index: 1,
+		rows: [][]node{
+			{{col: 0, kind: nodeChallenge, edges: []int{0}, challenge: &challenge{songs: songs[:2], selectCount: 1}}},
+			{{col: 0, kind: nodeChallenge, edges: []int{0}, challenge: &challenge{songs: songs, selectCount: 1}}},
+			{{col: 0, kind: nodeBoss}},
+		},
+	}
+	m := model{
+		acts:      []act{a},
+		allowed:   []int{0},
+		committed: map[int]int{},
+		runs:      map[int]nodeRun{},
+		voltage:   startingVoltage,
+	}
+
+	m.commitSelection()
+	m.toggleSongSelection()
+	m.confirmSelection()
+	m.starInput = "5"
+	m.submitStars()
+	m.confirmStars()
+	if !m.played["a"] || m.cursorRow != 1 {
+		t.Fatalf("submitted song should be recorded as played, got %v", m.played)
+	}
+
+	m.commitSelection()
+	if preview := renderNodePreview(m.selectedNode(), &m); !strings.Contains(preview, "Alpha — X • played") {
+		t.Fatalf("played songs should be marked in the pool:\n%s", preview)
+	}
+	m.toggleSongSelection()
+	if len(m.selectedSongs) != 0 || !strings.Contains(m.selectMessage, "already played Alpha") {
+		t.Fatalf("replay should be refused with a message, got %v / %q", m.selectedSongs, m.selectMessage)
+	}
+	m.moveSongSelection(1)
+	m.toggleSongSelection()
+	if len(m.selectedSongs) != 1 || m.selectMessage != "" {
+		t.Fatalf("a fresh song should be selectable and clear the message")
+	}
+
+	save := m.snapshot()
+	if len(save.Played) != 1 || save.Played[0] != "a" {
+		t.Fatalf("played songs should be saved, got %v", save.Played)
+	}
+}
+
+func TestElitesSitInMidActRows(t *testing.T) {
+	songs := compoundTestSongs()
+	for _, seed := range []int64{3, 21, 404} {
+		acts := generateRun(seed, songs, 7)
+		again := generateRun(seed, songs, 7)
+		for ai, a := range acts {
+			elites, candidates := 0, 0
+			for r, row := range a.rows {
+				if r >= eliteFirstRow && r < len(a.rows)-2 && row[0].kind != nodeShop {
+					candidates++
+				}
+				inRow := 0
+				for c, n := range row {
+					if n.kind != nodeElite {
+						continue
+					}
+					elites++
+					inRow++
+					if r < eliteFirstRow || r >= len(a.rows)-2 {
+						t.Fatalf("seed %d act %d: elite in row %d", seed, a.index, r)
+					}
+					ch := n.challenge
+					if ch.elite == nil || ch.goal != actGoal(a.index)+1 || !strings.HasPrefix(ch.name, "Elite ") {
+						t.Fatalf("seed %d act %d row %d: bad elite %+v", seed, a.index, r, ch)
+					}
+					for _, s := range ch.songs {
+						if ch.elite.floor > 0 && s.difficulty < ch.elite.floor {
+							t.Fatalf("seed %d act %d: %s under the tier %d floor", seed, a.index, s.id, ch.elite.floor)
+						}
+					}
+					if twin := again[ai].rows[r][c]; twin.kind != nodeElite || twin.challenge.id != ch.id {
+						t.Fatalf("seed %d act %d row %d: elites should be seeded", seed, a.index, r)
+					}
+				}
+				if inRow > 1 {
+					t.Fatalf("seed %d act %d row %d: %d elites in one row", seed, a.index, r, inRow)
+				}
+			}
+			if want := min(elitesForAct(a.index, standardRun.ElitesPerAct), candidates); elites != want {
+				t.Fatalf("seed %d act %d: %d elites, want %d", seed, a.index, elites, want)
+			}
+		}
+	}
+}
+
+func TestEliteSongsAreNotOfferedElsewhere(t *testing.T) {
+	var songs []song
+	for i := 0; i < 1400; i++ {
+		songs = append(songs, song{
+			id:         fmt.Sprintf("e%d", i),
+			title:      fmt.Sprintf("Elite Song %d", i),
+			artist:     fmt.Sprintf("Artist %d", i%40),
+			genre:      []string{"Rock", "Metal", "Pop", "Punk"}[i%4],
+			year:       1960 + i%60,
+			seconds:    150 + i%300,
+			difficulty: i % 7,
+		})
+	}
+	for _, seed := range []int64{3, 21, 404} {
+		acts := generateRun(seed, songs, 7)
+		owner := map[string]string{}
+		elites := 0
+		for _, a := range acts {
+			for r, row := range a.rows {
+				for c, n := range row {
+					if n.kind != nodeChallenge && n.kind != nodeElite {
+						continue
+					}
+					if n.kind == nodeElite {
+						elites++
+					}
+					here := fmt.Sprintf("act %d row %d col %d", a.index, r, c)
+					for _, s := range n.challenge.songs {
+						if prev, ok := owner[s.id]; ok && (n.kind == nodeElite || strings.HasPrefix(prev, "elite")) {
+							t.Fatalf("seed %d: %s offered at %s and %s", seed, s.id, prev, here)
+						}
+						if n.kind == nodeElite {
+							owner[s.id] = "elite " + here
+						} else if _, ok := owner[s.id]; !ok {
+							owner[s.id] = here
+						}
+					}
+				}
+			}
+		}
+		if elites == 0 {
+			t.Fatalf("seed %d: expected elites", seed)
+		}
+	}
+}
+
+func TestEliteRulesAndRewards(t *testing.T) {
+	songs := []song{{id: "a", title: "A", artist: "X"}, {id: "b", title: "B", artist: "X"}}
+	elite := func() *node {
+		return &node{kind: nodeElite, challenge: &challenge{
+			name: "Elite DecadeChallenge", songs: songs, selectCount: 2, goal: 4,
+			elite: &eliteRule{minStars: eliteMinStars, floor: 3},
+		}}
+	}
+	if passed, loss, bonus := resolveChallenge(elite(), []int{5, 4}); !passed || loss != 0 || bonus != eliteBonus {
+		t.Fatalf("clean elite should pay %d, got %v %d %d", eliteBonus, passed, loss, bonus)
+	}
+	// the average clears the goal but one song breaks the star floor
+	if passed, loss, bonus := resolveChallenge(elite(), []int{6, 3}); passed || loss != 1000 || bonus != 0 {
+		t.Fatalf("sub-4★ song should fail the elite, got %v %d %d", passed, loss, bonus)
+	}
+	if _, loss, _ := resolveChallenge(elite(), []int{2, 2}); loss != 4000 {
+		t.Fatalf("shortfall and floor misses should stack, got %d", loss)
+	}
+
+	n := elite()
+	if nodeGlyph(*n) != 'E' {
+		t.Fatalf("elite glyph should be E")
+	}
+	preview := renderNodePreview(n, nil)
+	for _, want := range []string{"Elite: no song under 4★, every song tier 3 or harder.", "Goal: average 4★", "Reward: $40 and a reroll token"} {
+		if !strings.Contains(preview, want) {
+			t.Fatalf("elite preview missing %q:\n%s", want, preview)
+		}
+	}
+
+	m := model{
+		acts:      []act{{index: 1, rows: [][]node{{*n}, {{kind: nodeBoss}}}}},
+		allowed:   []int{0},
+		committed: map[int]int{},
+		runs:      map[int]nodeRun{},
+		voltage:   startingVoltage,
+	}
+	m.acts[0].rows[0][0].edges = []int{0}
+	m.commitSelection()
+	m.toggleSongSelection()
+	m.moveSongSelection(1)
+	m.toggleSongSelection()
+	m.confirmSelection()
+	for _, stars := range []string{"5", "5"} {
+		m.starInput = stars
+		m.submitStars()
+	}
+	m.confirmStars()
+	if m.rerolls != 1 || m.currency != currencyForStars([]int{5, 5})+eliteBonus || !m.runs[0].passed {
+		t.Fatalf("cleared elite should pay cash and a token, got $%d and %d tokens", m.currency, m.rerolls)
+	}
+}
+
+func TestRestNodesOnePerAct(t *testing.T) {
+	for _, seed := range []int64{5, 77, 2024} {
+		acts := generateRun(seed, compoundTestSongs(), 7)
+		again := generateRun(seed, compoundTestSongs(), 7)
+		for ai, a := range acts {
+			rests := 0
+			for r, row := range a.rows {
+				for c, n := range row {
+					if n.kind != nodeRest {
+						continue
+					}
+					rests++
+					if r == 0 || r == len(a.rows)-1 || n.challenge != nil {
+						t.Fatalf("seed %d act %d: bad rest at row %d", seed, a.index, r)
+					}
+					if again[ai].rows[r][c].kind != nodeRest {
+						t.Fatalf("seed %d act %d: rest placement should be seeded", seed, a.index)
+					}
+				}
+			}
+			if rests != 1 {
+				t.Fatalf("seed %d act %d: %d rests, want 1", seed, a.index, rests)
+			}
+		}
+	}
+}
+
+func TestRestChoicesApplyAndAreRecorded(t *testing.T) {
+	songs := []song{{id: "a", title: "Alpha", artist: "X"}, {id: "b", title: "Bravo", artist: "X"}}
+	newRestModel := func() model {
+		a := act{
+			index: 1,
+			rows: [][]node{
+				{{col: 0, kind: nodeRest, edges: []int{0}}},
+				{
+					{col: 0, kind: nodeChallenge, edges: []int{0}, challenge: &challenge{name: "Near", songs: songs[:1], selectCount: 1}},
+					{col: 1, kind: nodeChallenge, edges: []int{0}, challenge: &challenge{name: "Far", songs: songs[1:], selectCount: 1}},
+				},
+				{{col: 0, kind: nodeBoss}},
+			},
+		}
+		return model{
+			acts:      []act{a},
+			allowed:   []int{0},
+			committed: map[int]int{},
+			runs:      map[int]nodeRun{},
+			voltage:   5000,
+		}
+	}
+
+	m := newRestModel()
+	next, _ := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = next.(model)
+	if !m.resting || !strings.Contains(renderNodePreview(&m.acts[0].rows[0][0], &m), "> Recover") {
+		t.Fatalf("enter on a rest node should open its options")
+	}
+	next, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = next.(model)
+	if m.voltage != 8000 || m.runs[0].rest != restRecover || m.cursorRow != 1 || m.resting {
+		t.Fatalf("recover should restore %d V and move on, got %d V, run %+v", restVoltage, m.voltage, m.runs[0])
+	}
+	if save := m.snapshot(); len(save.Results) != 1 || save.Results[0].Rest != "recover" {
+		t.Fatalf("rest choice should be saved, got %+v", save.Results)
+	}
+
+	m = newRestModel()
+	m.voltage = 9000
+	m.commitSelection()
+	m.moveRestCursor(1)
+	m.chooseRest()
+	if m.extraSlots != 1 || m.voltage != 9000 || m.runs[0].rest != restUpgrade {
+		t.Fatalf("rehearsing should grant an encore slot, got %d slots", m.extraSlots)
+	}
+
+	m = newRestModel()
+	if strings.Contains(renderNodePreview(&m.acts[0].rows[1][0], &m), "Alpha") {
+		t.Fatalf("pools stay hidden before practicing")
+	}
+	m.commitSelection()
+	m.moveRestCursor(2)
+	m.chooseRest()
+	if preview := renderNodePreview(m.selectedNode(), &m); !strings.Contains(preview, "Practiced") || !strings.Contains(preview, "Alpha — X") {
+		t.Fatalf("practice should reveal the reachable pool:\n%s", preview)
+	}
+	if m.practiced(1, 1) {
+		t.Fatalf("practice only reveals nodes the rest leads to")
+	}
+	m.cursorRow = 0
+	if preview := renderNodePreview(&m.acts[0].rows[0][0], &m); !strings.Contains(preview, "You chose: Practice") {
+		t.Fatalf("rest preview should show the recorded choice:\n%s", preview)
+	}
+}
+
+func TestEventNodesAreSeeded(t *testing.T) {
+	for _, seed := range []int64{8, 64, 512} {
+		acts := generateRun(seed, compoundTestSongs(), 7)
+		again := generateRun(seed, compoundTestSongs(), 7)
+		for ai, a := range acts {
+			events := 0
+			for r, row := range a.rows {
+				inRow := 0
+				for c, n := range row {
+					if n.kind != nodeUnknown {
+						continue
+					}
+					events++
+					inRow++
+					if n.event == nil || n.challenge != nil || r == 0 || r >= len(a.rows)-2 {
+						t.Fatalf("seed %d act %d: bad event node at row %d", seed, a.index, r)
+					}
+					if twin := again[ai].rows[r][c]; twin.event == nil || twin.event.id != n.event.id {
+						t.Fatalf("seed %d act %d: events should be seeded", seed, a.index)
+					}
+					if nodeGlyph(n) != '?' {
+						t.Fatalf("event nodes render as ?")
+					}
+				}
+				if inRow > 1 {
+					t.Fatalf("seed %d act %d row %d: %d events in one row", seed, a.index, r, inRow)
+				}
+			}
+			if events == 0 || events > standardRun.EventsPerAct {
+				t.Fatalf("seed %d act %d: %d events", seed, a.index, events)
+			}
+		}
+	}
+}
+
+func TestEventChoicesApplyToRun(t *testing.T) {
+	songs := []song{
+		{id: "easy", title: "Easy", artist: "X", difficulty: 2},
+		{id: "hard", title: "Hard", artist: "X", difficulty: 5},
+	}
+	newEventModel := func(id string) model {
+		a := act{
+			index: 2,
+			rows: [][]node{
+				{{col: 0, kind: nodeUnknown, edges: []int{0, 1}, event: &eventTable[0]}},
+				{
+					{col: 0, kind: nodeChallenge, edges: []int{0}, challenge: &challenge{songs: songs, selectCount: 1}},
+					{col: 1, kind: nodeChallenge, edges: []int{0}, challenge: &challenge{songs: songs, selectCount: 1}},
+				},
+				{{col: 0, kind: nodeChallenge, edges: []int{0}, challenge: &challenge{songs: songs, selectCount: 1}}},
+				{{col: 0, kind: nodeBoss}},
+			},
+		}
+		for i := range eventTable {
+			if eventTable[i].id == id {
+				a.rows[0][0].event = &eventTable[i]
+			}
+		}
+		return model{
+			acts:      []act{a},
+			allowed:   []int{0},
+			committed: map[int]int{},
+			runs:      map[int]nodeRun{},
+			voltage:   startingVoltage,
+		}
+	}
+
+	m := newEventModel("broken-string")
+	if preview := renderNodePreview(m.selectedNode(), &m); !strings.Contains(preview, "Event: ???") {
+		t.Fatalf("events stay hidden until entered:\n%s", preview)
+	}
+	m.commitSelection()
+	if preview := renderNodePreview(m.selectedNode(), &m); !strings.Contains(preview, "Broken String") || !strings.Contains(preview, "> Play on") {
+		t.Fatalf("entering should reveal the event:\n%s", preview)
+	}
+	m.moveEventCursor(1)
+	m.chooseEvent()
+	if !m.eventing || !strings.Contains(m.eventMessage, "Not enough cash") {
+		t.Fatalf("unaffordable choices should be refused, got %q", m.eventMessage)
+	}
+	m.moveEventCursor(-1)
+	m.chooseEvent()
+	if m.difficultyCap != brokenStringCap || m.cursorRow != 1 || m.runs[0].event != "broken-string:play-on" {
+		t.Fatalf("play on should cap the next picks, got cap %d run %+v", m.difficultyCap, m.runs[0])
+	}
+	m.commitSelection()
+	m.moveSongSelection(1)
+	m.toggleSongSelection()
+	if len(m.selectedSongs) != 0 || !strings.Contains(m.selectMessage, "Broken string") {
+		t.Fatalf("capped pick should be refused, got %v %q", m.selectedSongs, m.selectMessage)
+	}
+	m.moveSongSelection(-1)
+	m.toggleSongSelection()
+	m.confirmSelection()
+	m.starInput = "5"
+	m.submitStars()
+	m.confirmStars()
+	if m.difficultyCap != 0 {
+		t.Fatalf("the cap should clear after the challenge")
+	}
+
+	m = newEventModel("label-deal")
+	m.commitSelection()
+	m.chooseEvent()
+	if m.voltage != startingVoltage-labelDealVoltage || m.cursorRow != 2 || !m.runs[1].skipped {
+		t.Fatalf("signing should cost voltage and skip a row, got %d V row %d runs %+v", m.voltage, m.cursorRow, m.runs)
+	}
+	if save := m.snapshot(); len(save.Results) != 2 || save.Results[0].Event != "label-deal:sign" || !save.Results[1].Skipped {
+		t.Fatalf("event and skip should be saved, got %+v", save.Results)
+	}
+	m.cursorRow = 0
+	if preview := renderNodePreview(&m.acts[0].rows[0][0], &m); !strings.Contains(preview, "You chose: Sign") {
+		t.Fatalf("event preview should show the recorded choice:\n%s", preview)
+	}
+
+	m = newEventModel("groupie")
+	m.commitSelection()
+	m.chooseEvent()
+	if m.currency != 40 || !strings.Contains(m.eventMessage, "$40") {
+		t.Fatalf("merch should pay $20 per act, got %s / %q", formatCurrency(m.currency), m.eventMessage)
+	}
+}
+
+func TestActsUnlockAfterTheirBossAndKeepHistory(t *testing.T) {
+	songs := bossTestSongs()
+	path := filepath.Join(t.TempDir(), "save.json")
+	m := newModel(songs)
+	m.savePath = path
+	m.circle = 7
+	m.resetRun()
+
+	m.committed[0] = 0
+	m.runs[0] = nodeRun{col: 0, stars: []int{5, 5}, passed: true}
+	m.nextAct()
+	if m.currentAct != 0 || !strings.Contains(m.notice, "boss") {
+		t.Fatalf("act 2 should be locked before the boss, on act %d (%q)", m.currentAct+1, m.notice)
+	}
+
+	m.cursorRow = rowsPerAct - 1
+	m.allowed = []int{0}
+	m.cursorCol = 0
+	m.commitSelection()
+	for range m.selectedSongs {
+		m.starInput = "6"
+		m.submitStars()
+	}
+	m.confirmStars()
+	if m.currentAct != 1 || m.progressAct != 1 || m.readOnly() || m.cursorRow != 0 {
+		t.Fatalf("a resolved boss should open act 2 at the top: act %d row %d", m.currentAct+1, m.cursorRow)
+	}
+	if len(m.runs) != 0 || len(m.committed) != 0 {
+		t.Fatalf("act 2 should start with a clean slate")
+	}
+	if run := m.actRuns[0][0]; len(run.stars) != 2 {
+		t.Fatalf("act 1 results should be kept, got %+v", m.actRuns[0])
+	}
+	if run := m.actRuns[0][rowsPerAct-1]; !run.passed {
+		t.Fatalf("act 1 boss result should be kept, got %+v", run)
+	}
+
+	m.prevAct()
+	if m.currentAct != 0 || !m.readOnly() {
+		t.Fatalf("act 1 should be browsable read-only")
+	}
+	m.commitSelection()
+	if m.selectingSongs || m.enteringStars || m.resting || m.eventing || m.shopping {
+		t.Fatalf("read-only acts should not open nodes")
+	}
+	m.browseRow(rowsPerAct)
+	if m.cursorRow != rowsPerAct-1 || !strings.Contains(renderNodePreview(m.selectedNode(), &m), "Boss defeated!") {
+		t.Fatalf("browsing should show the boss result:\n%s", renderNodePreview(m.selectedNode(), &m))
+	}
+	m.browseRow(-rowsPerAct)
+	if m.cursorRow != 0 || m.cursorCol != 0 {
+		t.Fatalf("browsing should reach row 0 at the played node, got %d/%d", m.cursorRow, m.cursorCol)
+	}
+	m.nextAct()
+	if m.currentAct != 1 || m.readOnly() {
+		t.Fatalf("] should return to the act in progress")
+	}
+
+	save, err := readSave(path)
+	if err != nil {
+		t.Fatalf("readSave: %v", err)
+	}
+	if save.CurrentAct != 1 || len(save.History) != 1 || len(save.History[0].Results) != 2 {
+		t.Fatalf("save should keep act 1 in its history: %+v", save.History)
+	}
+	resumed := newModel(songs)
+	resumed.offerResume(save)
+	resumed.resumeSaved()
+	if resumed.currentAct != 1 || resumed.progressAct != 1 || len(resumed.actRuns[0]) != 2 {
+		t.Fatalf("resumed run lost its history: act %d, %+v", resumed.currentAct+1, resumed.actRuns[0])
+	}
+	if !resumed.played[songKey(m.actRuns[0][rowsPerAct-1].songs[0])] {
+		t.Fatalf("boss songs from history should count as played")
+	}
+
+	m.progressAct = len(m.acts) - 1
+	m.enterAct(m.progressAct)
+	m.completeAct()
+	if !m.runComplete || !m.readOnly() || !strings.Contains(m.notice, "Run complete") {
+		t.Fatalf("resolving the last boss should complete the run")
+	}
+	if save := m.snapshot(); !save.RunComplete || len(save.History) != len(m.acts)-1 {
+		t.Fatalf("save should record the finished run: %+v", save)
+	}
+}
+
+func TestStarEntryUndoAndConfirm(t *testing.T) {
+	songs := []song{{id: "a", title: "A"}, {id: "b", title: "B"}}
+	a := act{
+		index: 1,
+		rows: [][]node{
+			{{col: 0, kind: nodeChallenge, edges: []int{0}, challenge: &challenge{songs: songs, selectCount: 2, goal: 3}}},
+			{{col: 0, kind: nodeBoss}},
+		},
+	}
+	m := model{
+		acts:      []act{a},
+		allowed:   []int{0},
+		committed: map[int]int{},
+		runs:      map[int]nodeRun{},
+		voltage:   startingVoltage,
+	}
+	press := func(keys ...string) {
+		for _, k := range keys {
+			msg := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)}
+			switch k {
+			case "enter":
+				msg = tea.KeyMsg{Type: tea.KeyEnter}
+			case "backspace":
+				msg = tea.KeyMsg{Type: tea.KeyBackspace}
+			}
+			next, _ := m.Update(msg)
+			m = next.(model)
+		}
+	}
+
+	m.commitSelection()
+	m.selectedSongs = songs
+	m.startStarEntry()
+	press("5", "enter", "2", "enter")
+	if !m.confirmingStars || len(m.runs[0].stars) != 0 || m.voltage != startingVoltage {
+		t.Fatalf("results should wait on the confirm screen")
+	}
+	if preview := renderNodePreview(m.selectedNode(), &m); !strings.Contains(preview, "Confirm these results?") || !strings.Contains(preview, "Goal met") {
+		t.Fatalf("confirm screen should summarize the results:\n%s", preview)
+	}
+
+	press("u")
+	if !m.enteringStars || m.starEntryIdx != 1 || m.selectedStars[1] != 0 || m.selectedStars[0] != 5 {
+		t.Fatalf("undo should reopen the last song, got idx %d stars %v", m.starEntryIdx, m.selectedStars)
+	}
+	press("backspace")
+	if m.starEntryIdx != 0 || m.selectedStars[0] != 0 {
+		t.Fatalf("backspace on an empty prompt should undo again, got idx %d stars %v", m.starEntryIdx, m.selectedStars)
+	}
+	press("backspace")
+	if m.starEntryIdx != 0 || !m.enteringStars {
+		t.Fatalf("undo past the first song should do nothing")
+	}
+	press("5", "enter", "6", "enter", "enter")
+	if m.confirmingStars || m.runs[0].stars[1] != 6 || !m.runs[0].passed || m.cursorRow != 1 {
+		t.Fatalf("confirming should resolve the row, got %+v", m.runs[0])
+	}
+
+	press("u")
+	m.cursorRow, m.cursorCol = 0, 0
+	m.commitSelection()
+	if m.selectingSongs || m.enteringStars || m.runs[0].stars[1] != 6 || !strings.Contains(m.notice, "already resolved") {
+		t.Fatalf("a resolved row should not reopen, got %+v (%q)", m.runs[0], m.notice)
+	}
+}
+
+func TestConnectRowsKeepsMapsValid(t *testing.T) {
+	for seed := int64(1); seed <= 3000; seed++ {
+		rng := newMulberry32(seed)
+		a := act{index: 1}
+		rows := 2 + rng.Intn(6)
+		for r := 0; r < rows; r++ {
+			width := 1 + rng.Intn(6)
+			if r == rows-1 {
+				width = 1
+			}
+			row := make([]node, width)
+			for c := range row {
+				row[c] = node{col: c, kind: nodeChallenge}
+			}
+			if r == rows-1 {
+				row[0].kind = nodeBoss
+			}
+			if r > 0 {
+				connectRows(a.rows[r-1], row, rng)
+			}
+			a.rows = append(a.rows, row)
+		}
+		if err := validateAct(a); err != nil {
+			t.Fatalf("seed %d: %v", seed, err)
+		}
+	}
+}
+
+func TestGeneratedRunsPassValidation(t *testing.T) {
+	songs := bossTestSongs()
+	for seed := int64(1); seed <= 2000; seed++ {
+		for _, a := range generateRun(seed, songs, 7) {
+			if err := validateAct(a); err != nil {
+				t.Fatalf("seed %d: %v", seed, err)
+			}
+		}
+	}
+}
+
+func TestValidateActRejectsBrokenMaps(t *testing.T) {
+	build := func(edges ...[]int) act {
+		return act{index: 1, rows: [][]node{
+			{{col: 0, edges: edges[0]}, {col: 1, edges: edges[1]}},
+			{{col: 0, edges: []int{0}}, {col: 1, edges: []int{0}}},
+			{{col: 0, kind: nodeBoss}},
+		}}
+	}
+	if err := validateAct(build([]int{0}, []int{1})); err != nil {
+		t.Fatalf("valid map rejected: %v", err)
+	}
+	cases := map[string]act{
+		"crossing":  build([]int{1}, []int{0}),
+		"duplicate": build([]int{0, 0}, []int{1}),
+		"dead end":  build([]int{0, 1}, nil),
+		"orphan":    build([]int{0}, []int{0}),
+		"range":     build([]int{0}, []int{1, 2}),
+	}
+	for name, a := range cases {
+		if err := validateAct(a); err == nil {
+			t.Fatalf("%s map should fail validation", name)
+		}
+	}
+}
+
+func TestRenderActDrawsLongDiagonals(t *testing.T) {
+	a := act{index: 1, rows: [][]node{
+		{{col: 0, kind: nodeChallenge, edges: []int{2}}},
+		{{col: 0, kind: nodeChallenge, edges: []int{0}}, {col: 1, kind: nodeChallenge, edges: []int{0}}, {col: 2, kind: nodeChallenge, edges: []int{0}}},
+		{{col: 0, kind: nodeBoss}},
+	}}
+	lines := strings.Split(renderAct(a, -1, -1), "\n")[1:]
+	// a two-column edge gets two connector lines, stepping right on each
+	if len(lines) != 7 || !strings.HasPrefix(lines[3], "C   C   C") {
+		t.Fatalf("expected two connector lines per gap:\n%s", strings.Join(lines, "\n"))
+	}
+	if strings.Index(lines[1], `\`) != 3 || strings.Index(lines[2], `\`) != 5 {
+		t.Fatalf("diagonal should run toward its target:\n%s", strings.Join(lines, "\n"))
+	}
+	if !strings.Contains(lines[4], "/") || !strings.Contains(lines[5], "/") || lines[6][0] != 'B' {
+		t.Fatalf("edges into the boss should converge on it:\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+func TestRunConfigShapesGeneration(t *testing.T) {
+	songs := bossTestSongs()
+	for name, cfg := range runPresets {
+		if err := cfg.validate(); err != nil {
+			t.Fatalf("preset %s is invalid: %v", name, err)
+		}
+		for seed := int64(1); seed <= 200; seed++ {
+			acts := generateShapedRun(cfg, seed, songs, 7, nil)
+			if len(acts) != cfg.Acts {
+				t.Fatalf("%s: expected %d acts, got %d", name, cfg.Acts, len(acts))
+			}
+			for _, a := range acts {
+				if err := validateAct(a); err != nil {
+					t.Fatalf("%s seed %d: %v", name, seed, err)
+				}
+				if len(a.rows) != cfg.RowsPerAct {
+					t.Fatalf("%s: expected %d rows, got %d", name, cfg.RowsPerAct, len(a.rows))
+				}
+				counts := map[nodeKind]int{}
+				_, maxPool := cfg.poolBoundsForAct(a.index)
+				for _, row := range a.rows {
+					if len(row) > cfg.MaxNodesPerRow {
+						t.Fatalf("%s: row of %d nodes exceeds %d", name, len(row), cfg.MaxNodesPerRow)
+					}
+					for _, n := range row {
+						counts[n.kind]++
+						if n.kind == nodeChallenge && len(n.challenge.songs) > maxPool {
+							t.Fatalf("%s act %d: pool of %d exceeds %d", name, a.index, len(n.challenge.songs), maxPool)
+						}
+					}
+				}
+				if counts[nodeShop] > cfg.ShopsPerAct || counts[nodeRest] > cfg.RestsPerAct ||
+					counts[nodeUnknown] > cfg.EventsPerAct || counts[nodeElite] > elitesForAct(a.index, cfg.ElitesPerAct) {
+					t.Fatalf("%s act %d: special nodes over their limits: %v", name, a.index, counts)
+				}
+				boss := a.rows[len(a.rows)-1][0].challenge
+				if b := boss.boss; b.minEach > totalActs+2 || b.minTotal > len(boss.songs)*(totalActs+2) {
+					t.Fatalf("%s act %d: boss asks more than Act 3 would: %+v", name, a.index, *b)
+				}
+			}
+		}
+	}
+	if eliteDifficultyFloor(5) != eliteDifficultyFloor(totalActs) {
+		t.Fatalf("acts past the third should keep Act 3's elite floor")
+	}
+	party := generateShapedRun(runPresets["party"], 5, songs, 7, nil)
+	if standard := generateRun(5, songs, 7); len(party) == len(standard) {
+		t.Fatalf("the party preset should play a single act")
+	}
+}
+
+func TestRunConfigFromFileAndFlags(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.json")
+	if err := os.WriteFile(path, []byte(`{"acts": 1, "poolBounds": [{"min": 4, "max": 6}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fs := flag.NewFlagSet("longway", flag.ContinueOnError)
+	shape := addRunConfigFlags(fs)
+	if err := fs.Parse([]string{"--config", path, "--rows", "4", "--shops", "1"}); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := shape.resolve()
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if cfg.Acts != 1 || cfg.RowsPerAct != 4 || cfg.ShopsPerAct != 1 || cfg.MaxNodesPerRow != maxNodesPerRow {
+		t.Fatalf("file and flags should layer over the preset, got %+v", cfg)
+	}
+	if lo, hi := cfg.poolBoundsForAct(3); lo != 4 || hi != 6 {
+		t.Fatalf("later acts should reuse the last pool bounds, got %d-%d", lo, hi)
+	}
+
+	_, filename, _, _ := runtime.Caller(0)
+	example := filepath.Join(filepath.Dir(filename), "..", "..", "docs", "run.example.json")
+	if cfg, err := loadRunConfig(example, standardRun); err != nil || cfg.Acts != 2 {
+		t.Fatalf("docs/run.example.json should load: %v", err)
+	}
+
+	fs = flag.NewFlagSet("longway", flag.ContinueOnError)
+	shape = addRunConfigFlags(fs)
+	if err := fs.Parse([]string{"--preset", "marathon", "--min-width", "5", "--max-width", "3"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := shape.resolve(); err == nil || !strings.Contains(err.Error(), "row width") {
+		t.Fatalf("expected a row width error, got %v", err)
+	}
+	fs = flag.NewFlagSet("longway", flag.ContinueOnError)
+	shape = addRunConfigFlags(fs)
+	if err := fs.Parse([]string{"--preset", "endless"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := shape.resolve(); err == nil {
+		t.Fatalf("unknown presets should be rejected")
+	}
+}
+
+func TestRunShapeSurvivesSave(t *testing.T) {
+	songs := bossTestSongs()
+	path := filepath.Join(t.TempDir(), "save.json")
+	m := newShapedModel(songs, runPresets["party"])
+	m.savePath = path
+	m.circle = 7
+	m.choosingCircle = false
+	m.resetRun()
+	if len(m.acts) != 1 || !strings.Contains(m.View(), "Run shape: 1 act(s)") {
+		t.Fatalf("a party run should have one act and say so")
+	}
+
+	save, err := readSave(path)
+	if err != nil || save.Config == nil || save.Config.Acts != 1 {
+		t.Fatalf("save should record the run shape: %v %+v", err, save.Config)
+	}
+	resumed := newModel(songs)
+	resumed.offerResume(save)
+	resumed.resumeSaved()
+	if len(resumed.acts) != 1 || len(resumed.acts[0].rows) != len(m.acts[0].rows) {
+		t.Fatalf("resumed run should keep its shape, got %d acts", len(resumed.acts))
+	}
+
+	m.cursorRow = len(m.acts[0].rows) - 1
+	m.allowed = []int{0}
+	m.cursorCol = 0
+	m.commitSelection()
+	for range m.selectedSongs {
+		m.starInput = "6"
+		m.submitStars()
+	}
+	m.confirmStars()
+	if !m.runComplete {
+		t.Fatalf("beating the only boss should complete a single-act run")
+	}
+	if save := newModel(songs).snapshot(); save.Config != nil {
+		t.Fatalf("standard runs should not write a shape")
+	}
+}
+
+func TestConfiguredShapeAppliesToOpeningMapAndNewRuns(t *testing.T) {
+	songs := bossTestSongs()
+	party := runPresets["party"]
+	opening := newShapedModel(songs, party)
+	if len(opening.acts) != 1 || len(opening.acts[0].rows) != party.RowsPerAct {
+		t.Fatalf("the map behind the first circle picker should use the configured shape")
+	}
+	if save := opening.snapshot(); save.Config == nil || save.Config.Acts != 1 {
+		t.Fatalf("saving the opening map should record its shape, got %+v", save.Config)
+	}
+
+	path := filepath.Join(t.TempDir(), "save.json")
+	m := newShapedModel(songs, party)
+	m.savePath = path
+	m.circle = 7
+	m.choosingCircle = false
+	m.resetRun()
+	save, err := readSave(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resumed := newShapedModel(songs, standardRun)
+	resumed.offerResume(save)
+	resumed.resumeSaved()
+	if len(resumed.acts) != 1 {
+		t.Fatalf("resumed run should keep its saved shape, got %d acts", len(resumed.acts))
+	}
+	if s := resumed.snapshot(); s.Config == nil || s.Config.Acts != 1 {
+		t.Fatalf("re-saving a resumed run should keep its shape")
+	}
+	resumed.resetRun()
+	if len(resumed.acts) != totalActs || resumed.snapshot().Config != nil {
+		t.Fatalf("new runs should use the configured shape, got %d acts", len(resumed.acts))
+	}
+}
+
+func TestLeftShopStaysResolvedAcrossActSwitches(t *testing.T) {
+	songs := bossTestSongs()
+	m := newModel(songs)
+	m.circle = 7
+	m.resetRun()
+	m.progressAct = 1
+	m.enterAct(1)
+	shopRow := -1
+	for r, row := range m.acts[1].rows {
+		if row[0].kind == nodeShop {
+			shopRow = r
+			break
+		}
+	}
+	if shopRow < 0 {
+		t.Fatalf("act 2 should have a shop row")
+	}
+	for r := 0; r < shopRow; r++ {
+		m.committed[r] = 0
+		m.runs[r] = nodeRun{col: 0, stars: []int{5}}
+	}
+	m.enterAct(1)
+	if m.cursorRow != shopRow {
+		t.Fatalf("expected to resume on the shop row %d, got %d", shopRow, m.cursorRow)
+	}
+	m.commitSelection()
+	m.leaveShop()
+	if !m.runs[shopRow].shop || m.cursorRow != shopRow+1 {
+		t.Fatalf("leaving the shop should record it and move on, got row %d %+v", m.cursorRow, m.runs[shopRow])
+	}
+
+	m.prevAct()
+	save := m.snapshot()
+	m.nextAct()
+	if m.cursorRow != shopRow+1 {
+		t.Fatalf("[ then ] should return past the shop, got row %d", m.cursorRow)
+	}
+	if save.CurrentRow != shopRow+1 {
+		t.Fatalf("a save while browsing should resume past the shop, got row %d", save.CurrentRow)
+	}
+	resumed := newModel(songs)
+	resumed.offerResume(save)
+	resumed.resumeSaved()
+	if resumed.cursorRow != shopRow+1 || !resumed.runs[shopRow].shop {
+		t.Fatalf("resumed run should keep the shop visit, got row %d %+v", resumed.cursorRow, resumed.runs[shopRow])
+	}
+}
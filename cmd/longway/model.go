@@ -5,6 +5,7 @@ type node struct {
 	edges     []int // indices into the next row
 	kind      nodeKind
 	challenge *challenge
+	event     *randomEvent // set on "?" nodes
 }
 
 type act struct {
@@ -19,6 +20,8 @@ const (
 	nodeChallenge
 	nodeShop
 	nodeBoss
+	nodeElite
+	nodeRest
 )
 
 const (
@@ -28,10 +31,17 @@ const (
 	maxNodesPerRow        = 3
 	colSpacing            = 4
 	challengeSongListSize = 12
+	minSelectable         = 2
+	maxSelectable         = 5
 )
 
 type nodeRun struct {
-	col   int
-	songs []song
-	stars []int
+	col     int
+	songs   []song
+	stars   []int
+	passed  bool
+	rest    restChoice // set when the row was a rest node
+	event   string     // "event:choice" when the row was a "?" node
+	skipped bool       // passed through after a label deal
+	shop    bool       // visited the row's shop and left
 }
@@ -1,5 +1,7 @@
 package main
 
+import "fmt"
+
 func initAllowed(a act) []int {
 	cols := make([]int, len(a.rows[0]))
 	for i := range cols {
@@ -60,11 +62,29 @@ func (m *model) moveHorizontal(delta int) {
 }
 
 func (m *model) commitSelection() {
-	if m.selectingSongs || m.enteringStars {
+	if m.selectingSongs || m.enteringStars || m.confirmingStars || m.readOnly() {
+		return
+	}
+	if run, ok := m.runs[m.cursorRow]; ok && run.resolved() {
+		m.notice = "That node is already resolved; results can't be changed."
 		return
 	}
 	m.committed[m.cursorRow] = m.cursorCol
+	m.eventMessage = ""
+	m.notice = ""
 	n := m.selectedNode()
+	if n != nil && n.kind == nodeShop {
+		m.openShop()
+		return
+	}
+	if n != nil && n.kind == nodeRest {
+		m.openRest()
+		return
+	}
+	if n != nil && n.kind == nodeUnknown {
+		m.openEvent()
+		return
+	}
 	if n == nil || n.challenge == nil {
 		return
 	}
@@ -73,10 +93,18 @@ func (m *model) commitSelection() {
 	m.selectionIdx = 0
 	m.selectedSongs = nil
 	m.selectedStars = nil
+	m.selectMessage = ""
 	m.starInput = ""
 	m.runs[m.cursorRow] = nodeRun{col: m.cursorCol}
+	if n.kind == nodeBoss || n.challenge.ordered {
+		// bosses and album runs fix the setlist; go straight to star entry
+		m.selectedSongs = append([]song{}, n.challenge.songs...)
+		m.startStarEntry()
+	}
 }
 
+// submitStars records the typed stars for the current song and moves to the
+// next one. After the last song the results wait on the confirm screen.
 func (m *model) submitStars() {
 	if !m.enteringStars {
 		return
@@ -86,28 +114,126 @@ func (m *model) submitStars() {
 	}
 	val := clampDifficulty(parseDifficulty(m.starInput))
 	m.selectedStars[m.starEntryIdx] = val
+	m.starUndo = append(m.starUndo, m.starEntryIdx)
 	m.starInput = ""
 
 	m.starEntryIdx++
 	if m.starEntryIdx >= len(m.selectedSongs) {
 		m.enteringStars = false
-		run := m.runs[m.cursorRow]
-		run.songs = append([]song{}, m.selectedSongs...)
-		run.stars = append([]int{}, m.selectedStars...)
-		m.runs[m.cursorRow] = run
-
-		if m.cursorRow < len(m.acts[m.currentAct].rows)-1 {
-			m.cursorRow++
-			m.setAllowedForRow(m.cursorRow)
-			m.cursorCol = m.allowed[m.allowedIdx]
+		m.confirmingStars = true
+	}
+}
+
+// undoStar takes back the most recent star entry, reopening the prompt for
+// that song. Only entries for the challenge in progress are on the stack.
+func (m *model) undoStar() {
+	if (!m.enteringStars && !m.confirmingStars) || len(m.starUndo) == 0 {
+		return
+	}
+	idx := m.starUndo[len(m.starUndo)-1]
+	m.starUndo = m.starUndo[:len(m.starUndo)-1]
+	m.selectedStars[idx] = 0
+	m.starEntryIdx = idx
+	m.starInput = ""
+	m.confirmingStars = false
+	m.enteringStars = true
+}
+
+// chargedStars is what a challenge is judged on: an encore slot drops the
+// lowest result when the player picked an extra song.
+func (m model) chargedStars(stars []int) (charged []int, encore bool) {
+	if len(stars) > m.requiredSelection() && m.extraSlots > 0 {
+		return dropLowestStars(stars), true
+	}
+	return stars, false
+}
+
+// confirmStars resolves the row with the confirmed results. A resolved row is
+// final: it can be browsed but never re-entered.
+func (m *model) confirmStars() {
+	if !m.confirmingStars {
+		return
+	}
+	m.confirmingStars = false
+	m.starUndo = nil
+	run := m.runs[m.cursorRow]
+	if run.resolved() {
+		return
+	}
+	run.songs = append([]song{}, m.selectedSongs...)
+	run.stars = append([]int{}, m.selectedStars...)
+	if m.played == nil {
+		m.played = make(map[string]bool)
+	}
+	markUsed(m.played, run.songs)
+
+	charged, encore := m.chargedStars(run.stars)
+	if encore {
+		m.extraSlots--
+	}
+	var loss, bonus int
+	boss := m.selectedNode().kind == nodeBoss
+	run.passed, loss, bonus = resolveChallenge(m.selectedNode(), charged)
+	m.runs[m.cursorRow] = run
+	m.voltage, m.lastLoss = drainVoltage(m.voltage, loss)
+	m.currency += currencyForStars(run.stars) + bonus
+	m.difficultyCap = 0
+	if run.passed && m.selectedNode().kind == nodeElite {
+		m.rerolls++ // elites also pay out a reroll token
+	}
+	if m.voltage == 0 {
+		m.gameOver = true
+	}
+
+	m.advanceRow()
+	m.selectingSongs = false
+	m.selectedSongs = nil
+	m.selectedStars = nil
+	m.selectionPool = nil
+	m.starEntryIdx = 0
+	if boss && !m.gameOver {
+		m.completeAct()
+	}
+	m.autosave()
+}
+
+// resolveChallenge decides whether the results beat the node and what that
+// costs or earns. Challenges charge for the shortfall against their goal and
+// pay a bonus when met; elites also charge for every song under their star
+// floor and pay more; bosses charge every missed star unless their win
+// condition is met.
+func resolveChallenge(n *node, stars []int) (passed bool, loss, bonus int) {
+	if n == nil || n.challenge == nil {
+		return true, voltageLoss(stars), 0
+	}
+	c := n.challenge
+	if c.boss != nil {
+		if c.boss.met(stars) {
+			return true, 0, bossBonus
+		}
+		return false, voltageLoss(stars), 0
+	}
+	loss = goalVoltageLoss(c.goal, stars)
+	passed = meetsGoal(c.goal, stars)
+	if c.elite != nil {
+		passed = passed && c.elite.met(stars)
+		loss += c.elite.misses(stars) * voltagePenaltyPerMissingStar
+		if passed {
+			bonus = eliteBonus
 		}
-		m.selectingSongs = false
-		m.selectedSongs = nil
-		m.selectedStars = nil
-		m.selectionPool = nil
-		m.starEntryIdx = 0
-	} else {
-		// continue entering stars for next song
+		return passed, loss, bonus
+	}
+	if passed && c.goal > 0 {
+		bonus = goalBonus
+	}
+	return passed, loss, bonus
+}
+
+func (m *model) advanceRow() {
+	if m.cursorRow < len(m.acts[m.currentAct].rows)-1 {
+		m.cursorRow++
+		m.setAllowedForRow(m.cursorRow)
+		m.cursorCol = m.allowed[m.allowedIdx]
 	}
 }
 
@@ -132,6 +258,8 @@ func (m *model) toggleSongSelection() {
 	}
 	sel := m.selectionPool[m.selectionIdx]
 
+	m.selectMessage = ""
+
 	// check if already selected
 	for i, s := range m.selectedSongs {
 		if songKey(s) == songKey(sel) {
@@ -140,14 +268,46 @@ func (m *model) toggleSongSelection() {
 		}
 	}
 
-	if len(m.selectedSongs) >= 3 {
+	// a song counts once per run; fixed setlists (bosses, album runs) are
+	// the only way to meet one again
+	if m.played[songKey(sel)] {
+		m.selectMessage = fmt.Sprintf("You already played %s this run. Pick another track.", sel.title)
+		return
+	}
+	if m.capBlocks(sel) {
+		m.selectMessage = fmt.Sprintf("Broken string: pick a song at difficulty %d or lower.", m.difficultyCap)
+		return
+	}
+	if len(m.selectedSongs) >= m.selectLimit() {
 		return
 	}
-
 	m.selectedSongs = append(m.selectedSongs, sel)
-	if len(m.selectedSongs) == 3 {
-		m.startStarEntry()
+}
+
+// confirmSelection starts star entry once the challenge's count is picked.
+func (m *model) confirmSelection() {
+	if !m.selectingSongs || len(m.selectedSongs) < m.requiredSelection() {
+		return
+	}
+	m.startStarEntry()
+}
+
+// requiredSelection is the committed challenge's "pick N" count.
+func (m model) requiredSelection() int {
+	count := 0
+	if n := m.selectedNode(); n != nil && n.challenge != nil {
+		count = n.challenge.selectCount
+	}
+	return max(1, min(count, len(m.selectionPool)))
+}
+
+// selectLimit is the most songs the player may pick; an encore slot adds one.
+func (m model) selectLimit() int {
+	limit := m.requiredSelection()
+	if m.extraSlots > 0 && len(m.selectionPool) > limit {
+		limit++
 	}
+	return limit
 }
 
 func (m *model) startStarEntry() {
@@ -156,4 +316,5 @@ func (m *model) startStarEntry() {
 	m.selectedStars = make([]int, len(m.selectedSongs))
 	m.starEntryIdx = 0
 	m.starInput = ""
+	m.starUndo = nil
 }
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+const otherSeries = "Other"
+
+type sourceInfo struct {
+	source   string
+	series   string
+	included bool
+}
+
+type originGroup struct {
+	series  string
+	origins []string
+}
+
+// loadSourceInfo reads source_info.csv, which maps each song origin to its
+// series and whether the source is part of the playable catalog.
+func loadSourceInfo(path string) (map[string]sourceInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	sources := make(map[string]sourceInfo)
+	header := map[string]int{}
+	for {
+		rec, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(header) == 0 {
+			for i, col := range rec {
+				header[strings.ToLower(strings.TrimSpace(col))] = i
+			}
+			continue
+		}
+		name := field(rec, header["source"])
+		if name == "" {
+			continue
+		}
+		sources[name] = sourceInfo{
+			source:   name,
+			series:   field(rec, header["series"]),
+			included: !strings.EqualFold(field(rec, header["included"]), "false"),
+		}
+	}
+	return sources, nil
+}
+
+func seriesForSong(s song, sources map[string]sourceInfo) string {
+	if info, ok := sources[s.origin]; ok && info.series != "" {
+		return info.series
+	}
+	if s.series != "" {
+		return s.series
+	}
+	return otherSeries
+}
+
+func originIncluded(origin string, sources map[string]sourceInfo) bool {
+	info, ok := sources[origin]
+	return !ok || info.included
+}
+
+// collectOriginGroups lists the playable origins in the catalog grouped by
+// series, both sorted alphabetically.
+func collectOriginGroups(songs []song, sources map[string]sourceInfo) []originGroup {
+	bySeries := make(map[string]map[string]struct{})
+	for _, s := range songs {
+		if s.origin == "" || s.excluded || !originIncluded(s.origin, sources) {
+			continue
+		}
+		series := seriesForSong(s, sources)
+		if bySeries[series] == nil {
+			bySeries[series] = make(map[string]struct{})
+		}
+		bySeries[series][s.origin] = struct{}{}
+	}
+
+	groups := make([]originGroup, 0, len(bySeries))
+	for series, set := range bySeries {
+		g := originGroup{series: series}
+		for origin := range set {
+			g.origins = append(g.origins, origin)
+		}
+		sort.Strings(g.origins)
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].series < groups[j].series })
+	return groups
+}
+
+// filterSongsByOrigin drops excluded songs and sources and, when a selection
+// is given, keeps only songs from the selected origins. Songs without an
+// origin always pass. An empty result falls back to every included song.
+func filterSongsByOrigin(songs []song, sources map[string]sourceInfo, allowed map[string]bool) []song {
+	base := make([]song, 0, len(songs))
+	for _, s := range songs {
+		if !s.excluded && originIncluded(s.origin, sources) {
+			base = append(base, s)
+		}
+	}
+	if len(allowed) == 0 {
+		return base
+	}
+
+	filtered := make([]song, 0, len(base))
+	for _, s := range base {
+		if s.origin == "" || allowed[s.origin] {
+			filtered = append(filtered, s)
+		}
+	}
+	if len(filtered) == 0 {
+		return base
+	}
+	return filtered
+}
+
+func originList(selected map[string]bool) []string {
+	out := make([]string, 0, len(selected))
+	for origin, ok := range selected {
+		if ok {
+			out = append(out, origin)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func originSet(origins []string) map[string]bool {
+	if len(origins) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(origins))
+	for _, o := range origins {
+		set[o] = true
+	}
+	return set
+}
+
+// originPickerRow is one line of the origin selection screen: either a series
+// header (origin == "") or an origin within it.
+type originPickerRow struct {
+	series string
+	origin string
+}
+
+func originPickerRows(groups []originGroup) []originPickerRow {
+	var rows []originPickerRow
+	for _, g := range groups {
+		rows = append(rows, originPickerRow{series: g.series})
+		for _, o := range g.origins {
+			rows = append(rows, originPickerRow{series: g.series, origin: o})
+		}
+	}
+	return rows
+}
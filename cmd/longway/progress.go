@@ -0,0 +1,161 @@
+package main
+
+import "fmt"
+
+// resolved reports whether a row is finished: stars were entered, or the
+// player rested, answered an event, left a shop or skipped the row.
+func (r nodeRun) resolved() bool {
+	return len(r.stars) > 0 || r.rest != "" || r.event != "" || r.shop || r.skipped
+}
+
+// resetProgress clears the run history: every act gets empty choices and
+// results and only the first act is unlocked.
+func (m *model) resetProgress() {
+	m.actRuns = make([]map[int]nodeRun, len(m.acts))
+	m.actCommitted = make([]map[int]int, len(m.acts))
+	for i := range m.acts {
+		m.actRuns[i] = make(map[int]nodeRun)
+		m.actCommitted[i] = make(map[int]int)
+	}
+	m.progressAct = 0
+	m.runComplete = false
+}
+
+// ensureProgress builds a history around the live maps for models that were
+// set up without one, treating the act on screen as the one in progress.
+func (m *model) ensureProgress() {
+	if len(m.actRuns) == len(m.acts) {
+		return
+	}
+	committed, runs := m.committed, m.runs
+	progress := max(m.progressAct, m.currentAct)
+	m.resetProgress()
+	m.progressAct = progress
+	if committed != nil {
+		m.actCommitted[m.currentAct] = committed
+	}
+	if runs != nil {
+		m.actRuns[m.currentAct] = runs
+	}
+}
+
+// actState returns the choices and results recorded for an act. Models built
+// without a history (single-act tests) fall back to the live maps.
+func (m model) actState(i int) (map[int]int, map[int]nodeRun) {
+	if i < 0 || i >= len(m.actRuns) {
+		return m.committed, m.runs
+	}
+	return m.actCommitted[i], m.actRuns[i]
+}
+
+// readOnly is true while browsing an act whose boss has been resolved.
+func (m model) readOnly() bool {
+	return m.currentAct < m.progressAct || m.runComplete
+}
+
+// liveRow is the first row of the current act that has not been resolved.
+func (m model) liveRow() int {
+	rows := m.acts[m.currentAct].rows
+	for r := range rows {
+		if run, ok := m.runs[r]; !ok || !run.resolved() {
+			return r
+		}
+	}
+	return len(rows) - 1
+}
+
+// enterAct shows act i, keeping its history. Completed acts open at the top
+// for browsing; the act in progress resumes at its first unresolved row.
+func (m *model) enterAct(i int) {
+	m.ensureProgress()
+	m.currentAct = i
+	m.committed, m.runs = m.actState(i)
+	m.selectingSongs = false
+	m.enteringStars = false
+	m.selectionPool = nil
+	m.selectionIdx = 0
+	m.selectedSongs = nil
+	m.selectedStars = nil
+	m.selectMessage = ""
+	m.starEntryIdx = 0
+	m.starInput = ""
+	m.starUndo = nil
+	m.confirmingStars = false
+	m.shopping = false
+	m.resting = false
+	m.eventing = false
+	m.eventMessage = ""
+	m.shopItems = nil
+	m.shopMessage = ""
+	m.notice = ""
+
+	if m.readOnly() {
+		m.cursorRow = 0
+		m.browseRow(0)
+		return
+	}
+	m.cursorRow = m.liveRow()
+	m.setAllowedForRow(m.cursorRow)
+}
+
+// actStatus labels the act on screen in the header.
+func actStatus(m *model) string {
+	switch {
+	case m.runComplete:
+		return " (run complete)"
+	case m.readOnly():
+		return " (cleared, read-only)"
+	}
+	return ""
+}
+
+func (m *model) nextAct() {
+	if m.currentAct+1 >= len(m.acts) {
+		return
+	}
+	if m.currentAct+1 > m.progressAct {
+		m.notice = fmt.Sprintf("Resolve Act %d's boss to unlock the next act.", m.currentAct+1)
+		return
+	}
+	m.enterAct(m.currentAct + 1)
+}
+
+func (m *model) prevAct() {
+	if m.currentAct == 0 {
+		return
+	}
+	m.enterAct(m.currentAct - 1)
+}
+
+// browseRow moves the read-only cursor between rows; every node in the row
+// can be inspected.
+func (m *model) browseRow(delta int) {
+	if !m.readOnly() {
+		return
+	}
+	rows := m.acts[m.currentAct].rows
+	m.cursorRow = max(0, min(len(rows)-1, m.cursorRow+delta))
+	m.allowed = make([]int, len(rows[m.cursorRow]))
+	for i := range m.allowed {
+		m.allowed[i] = i
+	}
+	m.allowedIdx = 0
+	if col, ok := m.committed[m.cursorRow]; ok && col < len(m.allowed) {
+		m.allowedIdx = col
+	}
+	m.cursorCol = m.allowed[m.allowedIdx]
+}
+
+// completeAct runs once an act's boss is resolved, won or lost: the next act
+// unlocks and play moves there, or the run ends after the final act.
+func (m *model) completeAct() {
+	if m.currentAct+1 < len(m.acts) {
+		m.progressAct = max(m.progressAct, m.currentAct+1)
+		m.enterAct(m.progressAct)
+		m.notice = fmt.Sprintf("Act %d unlocked. Press [ to look back at earlier acts.", m.currentAct+1)
+		return
+	}
+	m.runComplete = true
+	m.browseRow(0)
+	m.notice = "Run complete! Browse your acts with [ and ], or press r for a new run."
+}
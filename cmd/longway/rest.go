@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+type restChoice string
+
+const (
+	restRecover  restChoice = "recover"
+	restUpgrade  restChoice = "upgrade"
+	restPractice restChoice = "practice"
+)
+
+const restVoltage = 3000
+
+type restOption struct {
+	choice  restChoice
+	name    string
+	summary string
+}
+
+var restOptions = []restOption{
+	{restRecover, "Recover", fmt.Sprintf("Restore %s V (up to the %s V start).", formatVoltage(restVoltage), formatVoltage(startingVoltage))},
+	{restUpgrade, "Rehearse with the band", "Gain an encore slot: pick one extra song next challenge."},
+	{restPractice, "Practice", "Reveal the song pools of the nodes this one leads to."},
+}
+
+func restOptionFor(choice restChoice) (restOption, bool) {
+	for _, opt := range restOptions {
+		if opt.choice == choice {
+			return opt, true
+		}
+	}
+	return restOption{}, false
+}
+
+// assignRest turns up to count challenge nodes per act into rests, one per
+// row, starting with the row before the boss and walking back past shop rows.
+// Elites are never replaced.
+func assignRest(a *act, seed int64, count int) {
+	rng := newMulberry32(sideSeed(seed, a.index, restStream))
+	for r := len(a.rows) - 2; r > 0 && count > 0; r-- {
+		var cols []int
+		for c, n := range a.rows[r] {
+			if n.kind == nodeChallenge {
+				cols = append(cols, c)
+			}
+		}
+		if len(cols) == 0 {
+			continue
+		}
+		n := &a.rows[r][cols[rng.Intn(len(cols))]]
+		n.kind = nodeRest
+		n.challenge = nil
+		count--
+	}
+}
+
+func (m *model) openRest() {
+	n := m.selectedNode()
+	if n == nil || n.kind != nodeRest {
+		return
+	}
+	m.resting = true
+	m.restIdx = 0
+}
+
+func (m *model) moveRestCursor(delta int) {
+	m.restIdx = max(0, min(len(restOptions)-1, m.restIdx+delta))
+}
+
+// chooseRest applies the highlighted option, records it for the row and moves
+// on. Practice has no immediate effect: the next row's pools show in their
+// previews because the choice is in the run history (see practiced).
+func (m *model) chooseRest() {
+	if !m.resting || m.restIdx < 0 || m.restIdx >= len(restOptions) {
+		return
+	}
+	opt := restOptions[m.restIdx]
+	switch opt.choice {
+	case restRecover:
+		m.voltage = min(startingVoltage, m.voltage+restVoltage)
+	case restUpgrade:
+		m.extraSlots++
+	}
+	m.runs[m.cursorRow] = nodeRun{col: m.cursorCol, rest: opt.choice}
+	m.resting = false
+	m.advanceRow()
+	m.autosave()
+}
+
+// practiced reports whether the player practiced at a rest in the previous
+// row that leads to this node, which reveals its pool before committing.
+func (m model) practiced(row, col int) bool {
+	if row <= 0 {
+		return false
+	}
+	prev, ok := m.runs[row-1]
+	if !ok || prev.rest != restPractice {
+		return false
+	}
+	rows := m.acts[m.currentAct].rows
+	if prev.col >= len(rows[row-1]) {
+		return false
+	}
+	for _, e := range rows[row-1][prev.col].edges {
+		if e == col {
+			return true
+		}
+	}
+	return false
+}
+
+func renderRestPreview(m *model) string {
+	var b strings.Builder
+	b.WriteString("Rest: catch your breath before the next stretch.\n")
+	if m == nil {
+		return strings.TrimRight(b.String(), "\n")
+	}
+	if run, ok := m.runs[m.cursorRow]; ok && run.col == m.cursorCol && run.rest != "" {
+		if opt, ok := restOptionFor(run.rest); ok {
+			b.WriteString(fmt.Sprintf("You chose: %s. %s", opt.name, opt.summary))
+		}
+		return b.String()
+	}
+	if !m.resting {
+		b.WriteString("\nPress enter to rest. Pick one: recover voltage, rehearse for an encore slot, or practice to reveal the next songs.")
+		return b.String()
+	}
+
+	b.WriteString("\n")
+	for i, opt := range restOptions {
+		cursor := "  "
+		if i == m.restIdx {
+			cursor = "> "
+		}
+		b.WriteString(fmt.Sprintf("%s%s — %s\n", cursor, opt.name, opt.summary))
+	}
+	b.WriteString("\nControls: ↑/↓ (k/j) choose • enter confirms • esc steps back")
+	return b.String()
+}
@@ -0,0 +1,115 @@
+package main
+
+// mulberry32 is the seeded PRNG shared with the web client
+// (web/src/lib/generator.js). It must stay bit-for-bit identical so a seed
+// produces the same run in both clients.
+type mulberry32 struct {
+	state uint32
+}
+
+func newMulberry32(seed int64) *mulberry32 {
+	// JS coerces the seed through ToUint32 on first use, i.e. modulo 2^32.
+	return &mulberry32{state: uint32(seed + 0x6d2b79f5)}
+}
+
+func (r *mulberry32) next() uint32 {
+	t := r.state
+	t = (t ^ (t >> 15)) * (t | 1)
+	t ^= t + (t^(t>>7))*(t|61)
+	r.state = t
+	return t ^ (t >> 14)
+}
+
+// Float64 returns a value in [0, 1), matching rng() in JS.
+func (r *mulberry32) Float64() float64 {
+	return float64(r.next()) / 4294967296
+}
+
+// Intn matches rngInt in JS: Math.floor(rng() * n).
+func (r *mulberry32) Intn(n int) int {
+	if n <= 0 {
+		return 0
+	}
+	return int(r.Float64() * float64(n))
+}
+
+// pickDistinct mirrors the JS helper: it draws indices until count unique
+// ones are found, in draw order.
+func (r *mulberry32) pickDistinct(size, count int) []int {
+	seen := make(map[int]struct{}, count)
+	picks := make([]int, 0, count)
+	for len(picks) < count && len(picks) < size {
+		v := r.Intn(size)
+		if _, ok := seen[v]; ok {
+			continue
+		}
+		seen[v] = struct{}{}
+		picks = append(picks, v)
+	}
+	return picks
+}
+
+// shuffleOrder returns a Fisher-Yates permutation of 0..n-1 using the same
+// draw order as shuffle() in JS.
+func (r *mulberry32) shuffleOrder(n int) []int {
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	for i := n - 1; i > 0; i-- {
+		j := int(r.Float64() * float64(i+1))
+		order[i], order[j] = order[j], order[i]
+	}
+	return order
+}
+
+// weightedOrder draws indices without replacement, each in proportion to its
+// weight among those left, matching weightedOrder() in JS. Indices with a
+// weight of zero or less are left out.
+func (r *mulberry32) weightedOrder(weights []int) []int {
+	var left []int
+	for i, w := range weights {
+		if w > 0 {
+			left = append(left, i)
+		}
+	}
+	order := make([]int, 0, len(left))
+	for len(left) > 1 {
+		total := 0
+		for _, i := range left {
+			total += weights[i]
+		}
+		roll := int(r.Float64() * float64(total))
+		pick := len(left) - 1
+		for k, i := range left {
+			roll -= weights[i]
+			if roll < 0 {
+				pick = k
+				break
+			}
+		}
+		order = append(order, left[pick])
+		left = append(left[:pick], left[pick+1:]...)
+	}
+	return append(order, left...)
+}
+
+// seedStream names a TUI-only side stream: bosses, elites, rests, events,
+// shops and rerolls draw from their own generators so they never consume
+// draws from the map generator the web client mirrors. The values are
+// per-act offsets.
+type seedStream int64
+
+const (
+	bossStream   seedStream = 1000003
+	eliteStream  seedStream = 2000003
+	restStream   seedStream = 3000017
+	eventStream  seedStream = 4000037
+	shopStream   seedStream = 5000011
+	rerollStream seedStream = 6000011
+)
+
+// sideSeed derives the seed for one act's side stream.
+func sideSeed(seed int64, actIndex int, stream seedStream) int64 {
+	return seed + int64(actIndex)*int64(stream)
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// saveVersion tracks the on-disk layout; it mirrors the web client's
+// longway-save-v1 payload so both clients describe a run the same way.
+const (
+	saveVersion  = 1
+	saveDirName  = "longway"
+	saveFileName = "longway-save-v1.json"
+)
+
+type savedRun struct {
+	Version    int           `json:"version"`
+	Seed       int64         `json:"seed"`
+	Circle     int           `json:"circle"`
+	Instrument string        `json:"instrument"`
+	CurrentAct int           `json:"currentAct"`
+	CurrentRow int           `json:"currentRow"`
+	Selected   savedCursor   `json:"selected"`
+	Choices    map[int]int   `json:"choices"`
+	Results    []savedResult `json:"results"`
+	Voltage    int           `json:"voltage"`
+	LastLoss   int           `json:"lastLoss,omitempty"`
+	GameOver   bool          `json:"gameOver"`
+	// Currency, tokens and bought offers are TUI-only shop state.
+	Currency   int      `json:"currency,omitempty"`
+	Rerolls    int      `json:"rerolls,omitempty"`
+	ExtraSlots int      `json:"extraSlots,omitempty"`
+	Purchases  []string `json:"purchases,omitempty"`
+	// RerollCount numbers reroll draws so a resumed run keeps drawing fresh
+	// pools; Redraws are the draws on rows still in progress, replayed over
+	// the regenerated map.
+	RerollCount int           `json:"rerollCount,omitempty"`
+	Redraws     []savedRedraw `json:"redraws,omitempty"`
+	// Played lists every song submitted in the run, across acts.
+	Played []string `json:"played,omitempty"`
+	// DifficultyCap is a pending broken-string event.
+	DifficultyCap int `json:"difficultyCap,omitempty"`
+	// History holds the choices and results of acts before CurrentAct, whose
+	// bosses are resolved; RunComplete marks the final boss resolved too
+	// (both TUI-only).
+	History     []savedAct `json:"history,omitempty"`
+	RunComplete bool       `json:"runComplete,omitempty"`
+	// Config is the run shape when it isn't the standard one (TUI-only).
+	Config *runConfig `json:"config,omitempty"`
+	// ChallengeDefs fingerprints the custom challenge definitions the map was
+	// generated with, if any (TUI-only).
+	ChallengeDefs string `json:"challengeDefs,omitempty"`
+	// SelectedOrigins is empty when every origin is allowed.
+	SelectedOrigins []string `json:"selectedOrigins"`
+	LastSaved       int64    `json:"lastSaved"`
+}
+
+type savedCursor struct {
+	Row int `json:"row"`
+	Col int `json:"col"`
+}
+
+type savedAct struct {
+	Act     int           `json:"act"`
+	Choices map[int]int   `json:"choices"`
+	Results []savedResult `json:"results"`
+}
+
+// savedRedraw is one reroll of the challenge at an act's row and column.
+type savedRedraw struct {
+	Act  int `json:"act"`
+	Row  int `json:"row"`
+	Col  int `json:"col"`
+	Draw int `json:"draw"`
+}
+
+type savedResult struct {
+	Row     int      `json:"row"`
+	Col     int      `json:"col"`
+	SongIDs []string `json:"songIds"`
+	Stars   []int    `json:"stars"`
+	Passed  bool     `json:"passed"`
+	// Rest is the option picked at a rest node, Event the "event:choice" at
+	// a "?" node, Shop a shop visited and left and Skipped a row passed after
+	// a label deal (TUI-only).
+	Rest    string `json:"rest,omitempty"`
+	Event   string `json:"event,omitempty"`
+	Shop    bool   `json:"shop,omitempty"`
+	Skipped bool   `json:"skipped,omitempty"`
+}
+
+func defaultSavePath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, saveDirName, saveFileName), nil
+}
+
+// snapshot records the run from the act in progress, whichever act is on
+// screen; completed acts go into History.
+func (m model) snapshot() savedRun {
+	m.ensureProgress()
+	committed, runs := m.actState(m.progressAct)
+	row, col := m.cursorRow, m.cursorCol
+	if m.currentAct != m.progressAct {
+		live := m
+		live.enterAct(m.progressAct)
+		row, col = live.cursorRow, live.cursorCol
+	}
+	save := savedRun{
+		Version:         saveVersion,
+		Seed:            m.seed,
+		Circle:          m.circle,
+		Instrument:      string(m.instrument),
+		CurrentAct:      m.progressAct,
+		CurrentRow:      row,
+		Selected:        savedCursor{Row: row, Col: col},
+		Choices:         savedChoices(committed),
+		Results:         savedResults(runs),
+		Voltage:         m.voltage,
+		LastLoss:        m.lastLoss,
+		GameOver:        m.gameOver,
+		Currency:        m.currency,
+		Rerolls:         m.rerolls,
+		RerollCount:     m.rerollCount,
+		ExtraSlots:      m.extraSlots,
+		DifficultyCap:   m.difficultyCap,
+		RunComplete:     m.runComplete,
+		ChallengeDefs:   defsFingerprint(customChallenges),
+		SelectedOrigins: originList(m.selectedOrigins),
+		LastSaved:       time.Now().UnixMilli(),
+	}
+	if shape := m.shape(); !shape.isStandard() {
+		save.Config = &shape
+	}
+	for i := 0; i < m.progressAct && i < len(m.actRuns); i++ {
+		committed, runs := m.actState(i)
+		save.History = append(save.History, savedAct{Act: i, Choices: savedChoices(committed), Results: savedResults(runs)})
+	}
+	for _, r := range m.redraws {
+		if !m.actRuns[r.Act][r.Row].resolved() {
+			save.Redraws = append(save.Redraws, r)
+		}
+	}
+	for key, ok := range m.purchased {
+		if ok {
+			save.Purchases = append(save.Purchases, key)
+		}
+	}
+	sort.Strings(save.Purchases)
+	for key := range m.played {
+		save.Played = append(save.Played, key)
+	}
+	sort.Strings(save.Played)
+	return save
+}
+
+func savedChoices(committed map[int]int) map[int]int {
+	choices := make(map[int]int, len(committed))
+	for row, col := range committed {
+		choices[row] = col
+	}
+	return choices
+}
+
+func savedResults(runs map[int]nodeRun) []savedResult {
+	rows := make([]int, 0, len(runs))
+	for row := range runs {
+		rows = append(rows, row)
+	}
+	sort.Ints(rows)
+	var results []savedResult
+	for _, row := range rows {
+		run := runs[row]
+		// in-progress rows are replayed from the committed node instead
+		if !run.resolved() {
+			continue
+		}
+		res := savedResult{Row: row, Col: run.col, Stars: append([]int{}, run.stars...), Passed: run.passed,
+			Rest: string(run.rest), Event: run.event, Shop: run.shop, Skipped: run.skipped}
+		for _, s := range run.songs {
+			res.SongIDs = append(res.SongIDs, songKey(s))
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+func writeSave(path string, save savedRun) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(save, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func readSave(path string) (savedRun, error) {
+	var save savedRun
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return save, err
+	}
+	if err := json.Unmarshal(data, &save); err != nil {
+		return save, err
+	}
+	if save.Version != saveVersion {
+		return save, fmt.Errorf("unsupported save version %d", save.Version)
+	}
+	return save, nil
+}
+
+func (m *model) autosave() {
+	if m.savePath == "" {
+		return
+	}
+	m.saveErr = writeSave(m.savePath, m.snapshot())
+}
+
+// restoreSave regenerates the seeded map and replays committed nodes and
+// star results on top of it.
+func (m *model) restoreSave(save savedRun) error {
+	m.seed = save.Seed
+	m.circle = clampCircle(save.Circle)
+	m.selectedOrigins = originSet(save.SelectedOrigins)
+	m.instrument = parseInstrument(save.Instrument)
+	m.runShape = standardRun
+	if save.Config != nil {
+		if err := save.Config.validate(); err != nil {
+			return fmt.Errorf("saved run shape: %w", err)
+		}
+		m.runShape = *save.Config
+	}
+	if save.ChallengeDefs != defsFingerprint(customChallenges) {
+		return errors.New("saved run was generated with different custom challenges; start with the same --challenges file to resume it")
+	}
+	runSongs := m.runSongs()
+	m.acts = generateShapedRun(m.runShape, m.seed, runSongs, m.circle, customChallenges)
+	if save.CurrentAct < 0 || save.CurrentAct >= len(m.acts) {
+		return errors.New("saved act out of range")
+	}
+	m.resetProgress()
+	m.progressAct = save.CurrentAct
+	m.runComplete = save.RunComplete
+
+	byKey := make(map[string]song, len(runSongs))
+	for _, s := range runSongs {
+		byKey[songKey(s)] = s
+	}
+	m.played = make(map[string]bool, len(save.Played))
+	for _, key := range save.Played {
+		m.played[key] = true
+	}
+	for _, past := range save.History {
+		if past.Act < 0 || past.Act >= save.CurrentAct {
+			return fmt.Errorf("saved history for act %d out of range", past.Act)
+		}
+		if err := m.restoreAct(past.Act, past.Choices, past.Results, byKey); err != nil {
+			return err
+		}
+	}
+	if err := m.restoreAct(save.CurrentAct, save.Choices, save.Results, byKey); err != nil {
+		return err
+	}
+	m.rerollCount = save.RerollCount
+	m.redraws = nil
+	for _, r := range save.Redraws {
+		if r.Act < 0 || r.Act >= len(m.acts) || r.Row < 0 || r.Row >= len(m.acts[r.Act].rows) ||
+			r.Col < 0 || r.Col >= len(m.acts[r.Act].rows[r.Row]) {
+			return fmt.Errorf("saved reroll at act %d row %d col %d out of range", r.Act, r.Row, r.Col)
+		}
+		if n := m.acts[r.Act].rows[r.Row][r.Col]; n.kind != nodeChallenge || n.challenge == nil {
+			return fmt.Errorf("saved reroll at act %d row %d is not a challenge", r.Act, r.Row)
+		}
+		m.redrawChallenge(r)
+		m.redraws = append(m.redraws, r)
+	}
+	m.enterAct(save.CurrentAct)
+
+	m.voltage = save.Voltage
+	m.lastLoss = save.LastLoss
+	m.gameOver = save.GameOver
+	m.currency = save.Currency
+	m.rerolls = save.Rerolls
+	m.extraSlots = save.ExtraSlots
+	m.difficultyCap = save.DifficultyCap
+	m.purchased = make(map[string]bool, len(save.Purchases))
+	for _, key := range save.Purchases {
+		m.purchased[key] = true
+	}
+
+	if m.runComplete {
+		return nil
+	}
+	rows := m.acts[m.currentAct].rows
+	m.cursorRow = save.CurrentRow
+	if m.cursorRow < 0 || m.cursorRow >= len(rows) {
+		m.cursorRow = 0
+	}
+	m.setAllowedForRow(m.cursorRow)
+	for i, col := range m.allowed {
+		if col == save.Selected.Col {
+			m.allowedIdx = i
+			m.cursorCol = col
+		}
+	}
+	// a committed row without results was interrupted mid-challenge; let the
+	// player re-enter it rather than leaving it locked
+	if _, ok := m.runs[m.cursorRow]; !ok {
+		delete(m.committed, m.cursorRow)
+	}
+	return nil
+}
+
+// restoreAct replays one act's saved choices and results into its history.
+func (m *model) restoreAct(i int, choices map[int]int, results []savedResult, byKey map[string]song) error {
+	rows := m.acts[i].rows
+	for row, col := range choices {
+		if row < 0 || row >= len(rows) || col < 0 || col >= len(rows[row]) {
+			return fmt.Errorf("saved choice row %d col %d out of range", row, col)
+		}
+		m.actCommitted[i][row] = col
+	}
+	for _, res := range results {
+		run := nodeRun{col: res.Col, stars: append([]int{}, res.Stars...), passed: res.Passed,
+			rest: restChoice(res.Rest), event: res.Event, shop: res.Shop, skipped: res.Skipped}
+		for _, id := range res.SongIDs {
+			m.played[id] = true
+			if s, ok := byKey[id]; ok {
+				run.songs = append(run.songs, s)
+			}
+		}
+		m.actRuns[i][res.Row] = run
+	}
+	return nil
+}
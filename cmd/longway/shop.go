@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+type shopItemKind int
+
+const (
+	itemVoltageSmall shopItemKind = iota
+	itemVoltageLarge
+	itemReroll
+	itemExtraSlot
+)
+
+const (
+	currencyPerStar = 10
+	goalBonus       = 20
+	bossBonus       = 50
+	shopOfferCount  = 3
+)
+
+type shopItemDef struct {
+	kind      shopItemKind
+	name      string
+	summary   string
+	basePrice int
+}
+
+var shopCatalog = []shopItemDef{
+	{itemVoltageSmall, "Fresh Batteries", "Restore 2,000 V.", 60},
+	{itemVoltageLarge, "Power Conditioner", "Restore 5,000 V.", 140},
+	{itemReroll, "Setlist Swap", "Reroll one challenge's song pool (r while picking songs).", 40},
+	{itemExtraSlot, "Encore Slot", "Pick one extra song in your next challenge; the lowest result is dropped.", 80},
+}
+
+type shopItem struct {
+	def   shopItemDef
+	price int
+}
+
+// shopSeed derives a per-shop seed so inventories are stable for a run seed
+// without touching the map generator's RNG stream.
+func shopSeed(seed int64, actIndex, row int) int64 {
+	return sideSeed(seed, actIndex, shopStream) + int64(row)
+}
+
+// shopInventory draws a seeded set of distinct offers for one shop node.
+func shopInventory(seed int64, actIndex, row int) []shopItem {
+	rng := newMulberry32(shopSeed(seed, actIndex, row))
+	count := min(shopOfferCount, len(shopCatalog))
+	items := make([]shopItem, 0, count)
+	for _, idx := range rng.pickDistinct(len(shopCatalog), count) {
+		def := shopCatalog[idx]
+		items = append(items, shopItem{def: def, price: shopPrice(def, actIndex, rng)})
+	}
+	return items
+}
+
+// shopPrice scales the base price by act (+50% per act) with up to ±20%
+// seeded variance, rounded to the nearest 5.
+func shopPrice(def shopItemDef, actIndex int, rng *mulberry32) int {
+	scaled := float64(def.basePrice) * (1 + 0.5*float64(max(0, actIndex-1)))
+	variance := 0.8 + 0.4*rng.Float64()
+	price := int(scaled*variance/5+0.5) * 5
+	return max(5, price)
+}
+
+func currencyForStars(stars []int) int {
+	total := 0
+	for _, s := range stars {
+		total += clampDifficulty(s)
+	}
+	return total * currencyPerStar
+}
+
+func formatCurrency(v int) string {
+	return fmt.Sprintf("$%d", v)
+}
+
+func purchaseKey(actIndex, row, idx int) string {
+	return fmt.Sprintf("%d:%d:%d", actIndex, row, idx)
+}
+
+func (m *model) openShop() {
+	n := m.selectedNode()
+	if n == nil || n.kind != nodeShop {
+		return
+	}
+	m.shopping = true
+	m.shopIdx = 0
+	m.shopItems = shopInventory(m.seed, m.acts[m.currentAct].index, m.cursorRow)
+	m.shopMessage = ""
+}
+
+func (m *model) moveShopCursor(delta int) {
+	if len(m.shopItems) == 0 {
+		return
+	}
+	m.shopIdx = max(0, min(len(m.shopItems)-1, m.shopIdx+delta))
+}
+
+// buyShopItem applies the highlighted offer to the run. Each offer can be
+// bought once per shop.
+func (m *model) buyShopItem() {
+	if !m.shopping || m.shopIdx < 0 || m.shopIdx >= len(m.shopItems) {
+		return
+	}
+	key := purchaseKey(m.acts[m.currentAct].index, m.cursorRow, m.shopIdx)
+	if m.purchased[key] {
+		m.shopMessage = "Already bought."
+		return
+	}
+	item := m.shopItems[m.shopIdx]
+	if m.currency < item.price {
+		m.shopMessage = fmt.Sprintf("Not enough cash for %s.", item.def.name)
+		return
+	}
+
+	switch item.def.kind {
+	case itemVoltageSmall:
+		m.voltage = min(startingVoltage, m.voltage+2000)
+	case itemVoltageLarge:
+		m.voltage = min(startingVoltage, m.voltage+5000)
+	case itemReroll:
+		m.rerolls++
+	case itemExtraSlot:
+		m.extraSlots++
+	}
+	m.currency -= item.price
+	if m.purchased == nil {
+		m.purchased = make(map[string]bool)
+	}
+	m.purchased[key] = true
+	m.shopMessage = fmt.Sprintf("Bought %s.", item.def.name)
+	m.autosave()
+}
+
+func (m *model) leaveShop() {
+	if !m.shopping {
+		return
+	}
+	m.shopping = false
+	m.shopItems = nil
+	m.shopMessage = ""
+	m.runs[m.cursorRow] = nodeRun{col: m.cursorCol, shop: true}
+	m.advanceRow()
+	m.autosave()
+}
+
+// rerollSelectionPool spends a reroll token to redraw the committed
+// challenge. The draw is recorded so a resumed run can replay it.
+func (m *model) rerollSelectionPool() {
+	if !m.selectingSongs || m.rerolls == 0 {
+		return
+	}
+	n := m.selectedNode()
+	if n == nil || n.kind != nodeChallenge || n.challenge == nil {
+		return
+	}
+	m.rerollCount++
+	redraw := savedRedraw{Act: m.currentAct, Row: m.cursorRow, Col: m.cursorCol, Draw: m.rerollCount}
+	m.redrawChallenge(redraw)
+	m.redraws = append(m.redraws, redraw)
+	m.rerolls--
+	m.selectionPool = n.challenge.songs
+	m.selectionIdx = 0
+	m.selectedSongs = nil
+	m.selectMessage = ""
+	m.autosave()
+}
+
+// redrawChallenge replaces a node's challenge with a reroll draw from the
+// act's catalog, leaving out the current pool and songs already played this
+// run while enough others remain. Rerolls happen mid-selection, so only
+// built-in challenges the player picks from are drawn.
+func (m *model) redrawChallenge(r savedRedraw) {
+	a := m.acts[r.Act]
+	n := &a.rows[r.Row][r.Col]
+	actSongs := applyActDifficultyConstraints(a.index, applyCircleIntensityConstraints(m.circle, m.runSongs()))
+	rng := newMulberry32(sideSeed(m.seed, a.index, rerollStream) + int64(r.Draw))
+	poolSize := pickPoolSize(m.shape(), a.index, len(actSongs), rng)
+	seen := make(map[string]bool, len(m.played)+len(n.challenge.songs))
+	for key := range m.played {
+		seen[key] = true
+	}
+	markUsed(seen, n.challenge.songs)
+	n.challenge = newUnorderedChallenge(a.index, freshSongs(actSongs, seen), rng, poolSize, n.challenge.selectCount)
+}
+
+// dropLowestStars removes the single worst result, which is what an encore
+// slot buys: an extra song whose weakest score does not cost voltage.
+func dropLowestStars(stars []int) []int {
+	if len(stars) < 2 {
+		return stars
+	}
+	low := 0
+	for i, s := range stars {
+		if s < stars[low] {
+			low = i
+		}
+	}
+	out := make([]int, 0, len(stars)-1)
+	out = append(out, stars[:low]...)
+	return append(out, stars[low+1:]...)
+}
+
+func renderShopPreview(m *model) string {
+	var b strings.Builder
+	b.WriteString("Shop: spend cash on gear for the road.\n")
+	b.WriteString(renderWallet(m) + "\n")
+	if m == nil || !m.shopping {
+		b.WriteString("\nPress enter to browse.")
+		return b.String()
+	}
+
+	b.WriteString("\n")
+	actIndex := m.acts[m.currentAct].index
+	for i, item := range m.shopItems {
+		cursor := "  "
+		if i == m.shopIdx {
+			cursor = "> "
+		}
+		price := formatCurrency(item.price)
+		if m.purchased[purchaseKey(actIndex, m.cursorRow, i)] {
+			price = "sold"
+		}
+		b.WriteString(fmt.Sprintf("%s%s (%s) — %s\n", cursor, item.def.name, price, item.def.summary))
+	}
+	if m.shopMessage != "" {
+		b.WriteString("\n" + m.shopMessage + "\n")
+	}
+	b.WriteString("\nControls: ↑/↓ (k/j) choose • enter buys • esc leaves the shop")
+	return b.String()
+}
+
+func renderWallet(m *model) string {
+	if m == nil {
+		return ""
+	}
+	return fmt.Sprintf("Cash: %s • Rerolls: %d • Encore slots: %d", formatCurrency(m.currency), m.rerolls, m.extraSlots)
+}
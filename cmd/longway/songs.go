@@ -1,10 +1,13 @@
 package main
 
 import (
+	"bytes"
 	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 )
@@ -14,12 +17,14 @@ type song struct {
 	title      string
 	artist     string
 	album      string
+	albumTrack int // position on the album; 0 when unknown
 	genre      string
 	difficulty int
 	length     string
 	year       int
 	seconds    int
 	origin     string
+	series     string
 	diffGuitar int
 	diffBass   int
 	diffDrums  int
@@ -27,9 +32,24 @@ type song struct {
 	diffKeys   int
 	diffRhythm int
 	diffCoop   int
+	// excluded marks songs whose source is not part of the playable catalog
+	// (source_included=false); the zero value keeps hand-built songs playable.
+	excluded       bool
+	supportsGuitar bool
+	supportsBass   bool
+	supportsDrums  bool
+	supportsVocals bool
 }
 
+// loadSongs reads a catalog, picking the format from the file extension.
 func loadSongs(path string) ([]song, error) {
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return loadSongsJSON(path)
+	}
+	return loadSongsCSV(path)
+}
+
+func loadSongsCSV(path string) ([]song, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
@@ -72,6 +92,74 @@ func loadSongs(path string) ([]song, error) {
 	return songs, nil
 }
 
+// catalogColumns are the JSON catalog keys read into a record, in the order
+// parseSong expects for its positional fallbacks.
+var catalogColumns = []string{
+	"id", "title", "artist", "album", "genre", "diff_band", "length", "year",
+	"seconds", "origin", "series", "difficulty",
+	"diff_guitar", "diff_bass", "diff_drums", "diff_vocals", "diff_keys", "diff_rhythm", "diff_guitar_coop",
+	"source_included", "supports_guitar", "supports_bass", "supports_drums", "supports_vocals",
+	"album_track",
+}
+
+// catalogValue accepts the mix of strings, numbers, booleans and nulls used in
+// downloaded_songs.json and keeps the raw text.
+type catalogValue string
+
+func (v *catalogValue) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		*v = ""
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*v = catalogValue(s)
+		return nil
+	}
+	*v = catalogValue(data)
+	return nil
+}
+
+func loadSongsJSON(path string) ([]song, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []map[string]catalogValue
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	header := make(map[string]int, len(catalogColumns))
+	for i, col := range catalogColumns {
+		header[col] = i
+	}
+
+	songs := make([]song, 0, len(entries))
+	for _, entry := range entries {
+		rec := make([]string, len(catalogColumns))
+		for i, col := range catalogColumns {
+			rec[i] = string(entry[col])
+		}
+		s, err := parseSong(rec, header)
+		if err != nil {
+			return nil, err
+		}
+		songs = append(songs, s)
+	}
+
+	if len(songs) == 0 {
+		return nil, fmt.Errorf("no songs loaded from %s", path)
+	}
+
+	return songs, nil
+}
+
 func isHeader(rec []string) bool {
 	if len(rec) < 5 {
 		return false
@@ -131,27 +219,51 @@ func parseSong(rec []string, header map[string]int) (song, error) {
 		}
 	}
 
+	band := get("diff_band", 5)
+	if band == "" {
+		band = get("difficulty", -1)
+	}
+
 	return song{
 		id:         id,
 		title:      title,
 		artist:     artist,
 		album:      album,
+		albumTrack: parseAlbumTrack(get("album_track", -1)),
 		genre:      genre,
-		difficulty: parseDifficulty(get("diff_band", 5)),
+		difficulty: parseDifficulty(band),
 		length:     length,
 		year:       parseYear(get("year", 7)),
 		seconds:    secondsVal,
 		origin:     get("origin", -1),
-		diffGuitar: parseDifficulty(get("diff_guitar", -1)),
-		diffBass:   parseDifficulty(get("diff_bass", -1)),
-		diffDrums:  parseDifficulty(get("diff_drums", -1)),
-		diffVocals: parseDifficulty(get("diff_vocals", -1)),
-		diffKeys:   parseDifficulty(get("diff_keys", -1)),
-		diffRhythm: parseDifficulty(get("diff_rhythm", -1)),
-		diffCoop:   parseDifficulty(get("diff_guitar_coop", -1)),
+		series:     get("series", -1),
+		diffGuitar: parsePartDifficulty(get("diff_guitar", -1)),
+		diffBass:   parsePartDifficulty(get("diff_bass", -1)),
+		diffDrums:  parsePartDifficulty(get("diff_drums", -1)),
+		diffVocals: parsePartDifficulty(get("diff_vocals", -1)),
+		diffKeys:   parsePartDifficulty(get("diff_keys", -1)),
+		diffRhythm: parsePartDifficulty(get("diff_rhythm", -1)),
+		diffCoop:   parsePartDifficulty(get("diff_guitar_coop", -1)),
+
+		excluded:       !parseFlag(get("source_included", -1), true),
+		supportsGuitar: parseFlag(get("supports_guitar", -1), false),
+		supportsBass:   parseFlag(get("supports_bass", -1), false),
+		supportsDrums:  parseFlag(get("supports_drums", -1), false),
+		supportsVocals: parseFlag(get("supports_vocals", -1), false),
 	}, nil
 }
 
+func parseFlag(val string, fallback bool) bool {
+	if val == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return fallback
+	}
+	return b
+}
+
 func parseYear(val string) int {
 	if val == "" {
 		return 0
@@ -163,6 +275,14 @@ func parseYear(val string) int {
 	return y
 }
 
+func parseAlbumTrack(val string) int {
+	n, err := strconv.Atoi(val)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
 func parseDurationToSeconds(val string) int {
 	if val == "" {
 		return 0
@@ -199,6 +319,19 @@ func parseDifficulty(val string) int {
 	return clampDifficulty(d)
 }
 
+// parsePartDifficulty keeps -1 for instrument parts the song does not have
+// (or does not list), so instrument runs can skip it.
+func parsePartDifficulty(val string) int {
+	if val == "" {
+		return -1
+	}
+	d, err := strconv.Atoi(val)
+	if err != nil || d < 0 {
+		return -1
+	}
+	return clampDifficulty(d)
+}
+
 func fallbackSong() song {
 	return song{
 		id:         "song-001",
@@ -212,12 +345,3 @@ func fallbackSong() song {
 		seconds:    245,
 	}
 }
-
-func findSongByTitle(songs []song, title string) (song, bool) {
-	for _, s := range songs {
-		if strings.EqualFold(s.title, title) {
-			return s, true
-		}
-	}
-	return song{}, false
-}
@@ -14,6 +14,13 @@ func min(a, b int) int {
 	return b
 }
 
+func abs(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
 func songKey(s song) string {
 	if s.id != "" {
 		return s.id
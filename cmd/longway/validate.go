@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type issueSeverity string
+
+const (
+	severityError   issueSeverity = "error"
+	severityWarning issueSeverity = "warning"
+)
+
+type catalogIssue struct {
+	Row      int           `json:"row"`
+	ID       string        `json:"id,omitempty"`
+	Severity issueSeverity `json:"severity"`
+	Code     string        `json:"code"`
+	Field    string        `json:"field,omitempty"`
+	Message  string        `json:"message"`
+}
+
+type catalogReport struct {
+	Path     string         `json:"path"`
+	Songs    int            `json:"songs"`
+	Errors   int            `json:"errors"`
+	Warnings int            `json:"warnings"`
+	Issues   []catalogIssue `json:"issues"`
+}
+
+// catalogRecord is one raw catalog row. CSV catalogs repeat some columns, so
+// every column keeps all of its values in file order.
+type catalogRecord struct {
+	row    int
+	fields map[string][]string
+}
+
+func (r catalogRecord) value(key string) string {
+	vals := r.fields[key]
+	if len(vals) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(vals[0])
+}
+
+var difficultyColumns = []string{
+	"diff_band", "diff_guitar", "diff_bass", "diff_drums", "diff_vocals",
+	"diff_keys", "diff_rhythm", "diff_guitar_coop",
+}
+
+var partSupportColumns = map[string]string{
+	"diff_guitar": "supports_guitar",
+	"diff_bass":   "supports_bass",
+	"diff_drums":  "supports_drums",
+	"diff_vocals": "supports_vocals",
+}
+
+func readCatalogRecords(path string) ([]catalogRecord, error) {
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return readJSONRecords(path)
+	}
+	return readCSVRecords(path)
+}
+
+func readCSVRecords(path string) ([]catalogRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	var header []string
+	var records []catalogRecord
+	line := 0
+	for {
+		rec, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line++
+		if header == nil {
+			if isHeader(rec) {
+				header = make([]string, len(rec))
+				for i, col := range rec {
+					header[i] = strings.ToLower(strings.TrimSpace(col))
+				}
+				continue
+			}
+			// headerless catalogs use the positional layout parseSong falls back to
+			header = []string{"id", "title", "artist", "album", "genre", "diff_band", "length", "year"}
+		}
+		fields := make(map[string][]string)
+		for i, val := range rec {
+			key := fmt.Sprintf("column_%d", i+1)
+			if i < len(header) {
+				key = header[i]
+			}
+			fields[key] = append(fields[key], val)
+		}
+		records = append(records, catalogRecord{row: line, fields: fields})
+	}
+	return records, nil
+}
+
+func readJSONRecords(path string) ([]catalogRecord, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []map[string]catalogValue
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	records := make([]catalogRecord, len(entries))
+	for i, entry := range entries {
+		fields := make(map[string][]string, len(entry))
+		for k, v := range entry {
+			fields[strings.ToLower(k)] = []string{string(v)}
+		}
+		records[i] = catalogRecord{row: i + 1, fields: fields}
+	}
+	return records, nil
+}
+
+// validateCatalog reports every problem it finds instead of stopping at the
+// first bad row the way loadSongs does.
+func validateCatalog(path string, records []catalogRecord) catalogReport {
+	report := catalogReport{Path: path, Songs: len(records)}
+	add := func(rec catalogRecord, sev issueSeverity, code, field, msg string) {
+		report.Issues = append(report.Issues, catalogIssue{
+			Row:      rec.row,
+			ID:       rec.value("id"),
+			Severity: sev,
+			Code:     code,
+			Field:    field,
+			Message:  msg,
+		})
+	}
+
+	idRows := make(map[string]int)
+	titleRows := make(map[string]int)
+	for _, rec := range records {
+		for _, key := range []string{"id", "title", "artist"} {
+			if rec.value(key) == "" {
+				add(rec, severityError, "missing-"+key, key, fmt.Sprintf("%s is empty", key))
+			}
+		}
+
+		if id := rec.value("id"); id != "" {
+			if first, ok := idRows[id]; ok {
+				add(rec, severityError, "duplicate-id", "id", fmt.Sprintf("id %q also used on row %d", id, first))
+			} else {
+				idRows[id] = rec.row
+			}
+		}
+
+		title, artist := rec.value("title"), rec.value("artist")
+		if title != "" && artist != "" {
+			key := strings.ToLower(title) + "|" + strings.ToLower(artist)
+			if first, ok := titleRows[key]; ok {
+				add(rec, severityWarning, "duplicate-song", "title", fmt.Sprintf("%q by %s also listed on row %d", title, artist, first))
+			} else {
+				titleRows[key] = rec.row
+			}
+		}
+
+		keys := make([]string, 0, len(rec.fields))
+		for key := range rec.fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			vals := rec.fields[key]
+			for _, v := range vals[1:] {
+				if strings.TrimSpace(v) != strings.TrimSpace(vals[0]) {
+					add(rec, severityError, "conflicting-column", key,
+						fmt.Sprintf("duplicate %s columns disagree (%q vs %q)", key, vals[0], v))
+					break
+				}
+			}
+		}
+
+		length := rec.value("length")
+		if length != "" && !validDuration(length) {
+			add(rec, severityError, "bad-length", "length", fmt.Sprintf("cannot parse length %q", length))
+		}
+		if secs := rec.value("seconds"); secs != "" {
+			if _, err := strconv.Atoi(secs); err != nil {
+				add(rec, severityError, "bad-number", "seconds", fmt.Sprintf("cannot parse seconds %q", secs))
+			}
+		} else if length == "" {
+			add(rec, severityWarning, "missing-length", "length", "no length or seconds; length challenges will skip it")
+		}
+		if year := rec.value("year"); year != "" {
+			if _, err := strconv.Atoi(year); err != nil {
+				add(rec, severityError, "bad-number", "year", fmt.Sprintf("cannot parse year %q", year))
+			}
+		}
+
+		for _, key := range difficultyColumns {
+			raw := rec.value(key)
+			if raw == "" {
+				continue
+			}
+			d, err := strconv.Atoi(raw)
+			switch {
+			case err != nil:
+				add(rec, severityError, "bad-difficulty", key, fmt.Sprintf("cannot parse %s %q", key, raw))
+			case d == -1 && key == "diff_band":
+				add(rec, severityError, "unrated-difficulty", key, "diff_band is -1; the song cannot be tiered")
+			case d == -1:
+				// -1 means "no part"; it is only suspicious if the source claims support
+				if support, ok := partSupportColumns[key]; ok && parseFlag(rec.value(support), false) {
+					add(rec, severityWarning, "unrated-difficulty", key, fmt.Sprintf("%s is -1 but %s is true", key, support))
+				}
+			case d < -1 || d > 6:
+				add(rec, severityWarning, "difficulty-range", key, fmt.Sprintf("%s %d is outside 0-6 and will be clamped", key, d))
+			}
+		}
+	}
+
+	for _, issue := range report.Issues {
+		if issue.Severity == severityError {
+			report.Errors++
+		} else {
+			report.Warnings++
+		}
+	}
+	return report
+}
+
+func writeCatalogReport(w io.Writer, report catalogReport) {
+	for _, issue := range report.Issues {
+		id := ""
+		if issue.ID != "" {
+			id = fmt.Sprintf(" [%s]", issue.ID)
+		}
+		fmt.Fprintf(w, "row %d%s: %s %s: %s\n", issue.Row, id, issue.Severity, issue.Code, issue.Message)
+	}
+	fmt.Fprintf(w, "%s: %d songs, %d errors, %d warnings\n", report.Path, report.Songs, report.Errors, report.Warnings)
+}
+
+// runCatalogCommand handles `longway catalog validate [--format text|json] [path]`
+// and returns the process exit code.
+func runCatalogCommand(args []string, stdout, stderr io.Writer) int {
+	usage := "usage: longway catalog validate [--format text|json] [catalog]"
+	if len(args) == 0 || args[0] != "validate" {
+		fmt.Fprintln(stderr, usage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("catalog validate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	format := fs.String("format", "text", "report format: text or json")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Fprintln(stderr, usage)
+		return 2
+	}
+
+	path := songsFile
+	if fs.NArg() > 0 {
+		path = fs.Arg(0)
+	}
+
+	records, err := readCatalogRecords(path)
+	if err != nil {
+		fmt.Fprintln(stderr, "could not read catalog:", err)
+		return 1
+	}
+	report := validateCatalog(path, records)
+
+	if *format == "json" {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			fmt.Fprintln(stderr, "could not write report:", err)
+			return 1
+		}
+	} else {
+		writeCatalogReport(stdout, report)
+	}
+
+	if report.Errors > 0 {
+		return 1
+	}
+	return 0
+}
+
+func validDuration(val string) bool {
+	if !strings.Contains(val, ":") {
+		_, err := strconv.Atoi(val)
+		return err == nil
+	}
+	parts := strings.Split(val, ":")
+	if len(parts) != 2 {
+		return false
+	}
+	for _, p := range parts {
+		if _, err := strconv.Atoi(p); err != nil {
+			return false
+		}
+	}
+	return true
+}
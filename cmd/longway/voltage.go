@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+const (
+	startingVoltage              = 10000
+	voltagePenaltyPerMissingStar = 1000
+	lowVoltageThreshold          = 3000
+	maxStars                     = 6
+)
+
+// voltageLoss charges for every star missed on each submitted song.
+func voltageLoss(stars []int) int {
+	loss := 0
+	for _, s := range stars {
+		missing := maxStars - clampDifficulty(s)
+		loss += missing * voltagePenaltyPerMissingStar
+	}
+	return loss
+}
+
+// goalVoltageLoss charges 1,000 V per whole star the average falls short of
+// the goal, like calculateVoltageLoss in the web client. Without a goal it
+// falls back to voltageLoss.
+func goalVoltageLoss(goal int, stars []int) int {
+	if goal <= 0 {
+		return voltageLoss(stars)
+	}
+	if len(stars) == 0 {
+		return 0
+	}
+	deficit := int(math.Ceil(float64(goal) - averageStars(stars)))
+	return max(0, deficit) * voltagePenaltyPerMissingStar
+}
+
+func applyVoltageLoss(current int, stars []int) (int, int) {
+	return drainVoltage(current, voltageLoss(stars))
+}
+
+func drainVoltage(current, loss int) (int, int) {
+	remaining := current - loss
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining, loss
+}
+
+func formatVoltage(v int) string {
+	raw := strconv.Itoa(v)
+	if v < 0 {
+		raw = raw[1:]
+	}
+	out := ""
+	for i, ch := range raw {
+		if i > 0 && (len(raw)-i)%3 == 0 {
+			out += ","
+		}
+		out += string(ch)
+	}
+	if v < 0 {
+		out = "-" + out
+	}
+	return fmt.Sprintf("%s V", out)
+}
@@ -1,30 +1,61 @@
 package main
 
-import "math/rand"
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+)
 
-func generateRun(seed int64, songs []song) []act {
-	rng := rand.New(rand.NewSource(seed))
-	acts := make([]act, totalActs)
-	for i := 0; i < totalActs; i++ {
-		acts[i] = generateAct(i+1, rng, songs)
+// generateRun builds a standard run without custom challenges, the run the
+// web client shares.
+func generateRun(seed int64, songs []song, circle int) []act {
+	return generateShapedRun(standardRun, seed, songs, circle, nil)
+}
+
+// generateShapedRun builds a run of any shape; defs are the custom challenge
+// definitions that join the built-in creators.
+func generateShapedRun(cfg runConfig, seed int64, songs []song, circle int, defs []challengeDef) []act {
+	rng := newMulberry32(seed)
+	circleSongs := applyCircleIntensityConstraints(circle, songs)
+	acts := make([]act, cfg.Acts)
+	used := make(map[string]bool)
+	for i := range acts {
+		acts[i] = generateAct(cfg, i+1, rng, circleSongs, used, defs)
+	}
+	// The TUI-only nodes go on once every shared draw is done, so elites can
+	// avoid the whole run's songs without shifting the web client's map.
+	for i := range acts {
+		assignElites(cfg, &acts[i], seed, circleSongs, used, defs)
+		assignRest(&acts[i], seed, cfg.RestsPerAct)
+		assignEvents(&acts[i], seed, cfg.EventsPerAct)
+		assignBoss(&acts[i], seed, circleSongs, used)
 	}
 	return acts
 }
 
-func generateAct(index int, rng *rand.Rand, songs []song) act {
+// generateAct builds one act's map. used collects every song offered so far
+// in the run; later nodes draw from the songs not yet offered while enough
+// remain (see freshSongs).
+func generateAct(cfg runConfig, index int, rng *mulberry32, songs []song, used map[string]bool, defs []challengeDef) act {
 	actSongs := applyActDifficultyConstraints(index, songs)
-	poolSize := pickPoolSize(index, len(actSongs), rng)
-	shopRows := pickShopRows(rng)
-	rows := make([][]node, rowsPerAct)
-	for row := 0; row < rowsPerAct; row++ {
-		count := minNodesPerRow + rng.Intn(maxNodesPerRow-minNodesPerRow+1)
-		if row == rowsPerAct-1 || shopRows[row] {
+	shopRows := pickShopRows(rng, cfg.RowsPerAct, cfg.ShopsPerAct)
+	lastRow := cfg.RowsPerAct - 1
+	rows := make([][]node, cfg.RowsPerAct)
+	for row := range rows {
+		maxAllowed := cfg.MaxNodesPerRow
+		if row > 0 {
+			maxAllowed = min(cfg.MaxNodesPerRow, len(rows[row-1])*2)
+		}
+		count := cfg.MinNodesPerRow + rng.Intn(cfg.MaxNodesPerRow-cfg.MinNodesPerRow+1)
+		count = max(1, min(count, maxAllowed))
+		if row == lastRow || shopRows[row] {
 			count = 1 // boss or shop
 		}
 		nodes := make([]node, count)
 		for i := range nodes {
 			kind := nodeChallenge
-			if row == rowsPerAct-1 {
+			if row == lastRow {
 				kind = nodeBoss
 			} else if shopRows[row] {
 				kind = nodeShop
@@ -33,10 +64,13 @@ func generateAct(index int, rng *rand.Rand, songs []song) act {
 				col:  i,
 				kind: kind,
 			}
+			// pool size and select count are drawn for every node to keep
+			// the RNG stream aligned with the web generator
+			poolSize := pickPoolSize(cfg, index, len(actSongs), rng)
+			selectCount := pickSelectCount(rng)
 			if kind == nodeChallenge {
-				nodes[i].challenge = newChallenge(actSongs, rng, poolSize)
-			} else if kind == nodeBoss {
-				nodes[i].challenge = bossChallenge(songs)
+				nodes[i].challenge = newChallenge(index, freshSongs(actSongs, used), rng, poolSize, selectCount, defs)
+				markUsed(used, nodes[i].challenge.songs)
 			}
 		}
 		if row > 0 {
@@ -51,78 +85,202 @@ func generateAct(index int, rng *rand.Rand, songs []song) act {
 	}
 }
 
-func pickShopRows(rng *rand.Rand) map[int]bool {
-	shopCount := 2
+func pickShopRows(rng *mulberry32, rows, shopCount int) map[int]bool {
 	candidates := []int{}
-	for r := 1; r < rowsPerAct-1; r++ { // avoid first and last rows
+	for r := 1; r < rows-1; r++ { // avoid first and last rows
 		candidates = append(candidates, r)
 	}
 	selected := map[int]bool{}
+	if len(candidates) == 0 || shopCount == 0 {
+		return selected
+	}
 	attempts := 0
-	for len(selected) < shopCount && attempts < 100 {
+	for len(selected) < shopCount && attempts < 50 {
 		r := candidates[rng.Intn(len(candidates))]
 		// no back-to-back
-		if selected[r-1] || selected[r+1] {
+		if selected[r] || selected[r-1] || selected[r+1] {
 			attempts++
 			continue
 		}
 		selected[r] = true
 	}
 	// ensure we have the desired count by spacing if needed
-	for len(selected) < shopCount && len(candidates) > 0 {
-		for _, r := range candidates {
-			if selected[r] || selected[r-1] || selected[r+1] {
-				continue
-			}
-			selected[r] = true
-			if len(selected) >= shopCount {
-				break
-			}
+	for _, r := range candidates {
+		if len(selected) >= shopCount {
+			break
 		}
+		if selected[r] || selected[r-1] || selected[r+1] {
+			continue
+		}
+		selected[r] = true
 	}
 	return selected
 }
 
-func connectRows(prev []node, next []node, rng *rand.Rand) {
-	incoming := make([]int, len(next))
+// connectRows fans each previous node out to an evenly spaced target, then
+// optionally adds a second edge to the neighbouring target. Targets never
+// decrease from left to right, so edges never cross. Any next node left
+// without an inbound edge joins the nearer of the two previous nodes whose
+// targets bracket it, which keeps the row crossing-free and fully reachable.
+func connectRows(prev []node, next []node, rng *mulberry32) {
+	if len(prev) == 0 || len(next) == 0 {
+		return
+	}
 
-	// ensure every next node has an inbound edge by building a spanning pass first
-	for j := range next {
-		src := rng.Intn(len(prev))
-		prev[src].edges = append(prev[src].edges, j)
-		incoming[j]++
+	assignments := make([]int, 0, len(prev))
+	for i := range prev {
+		target := 0
+		if len(prev) > 1 {
+			target = jsRound(float64(i*(len(next)-1)) / float64(len(prev)-1))
+		}
+		if len(assignments) > 0 && target < assignments[len(assignments)-1] {
+			target = assignments[len(assignments)-1]
+		}
+		target = min(target, len(next)-1)
+		assignments = append(assignments, target)
+		prev[i].edges = []int{target}
 	}
 
-	// add extra edges for branching
 	for i := range prev {
-		targets := pickTargets(len(next), rng)
-		for _, t := range targets {
-			prev[i].edges = append(prev[i].edges, t)
-			incoming[t]++
+		current := assignments[i]
+		nextTarget := len(next) - 1
+		if i+1 < len(assignments) {
+			nextTarget = assignments[i+1]
+		}
+		candidate := current + 1
+		if candidate <= nextTarget && candidate < len(next) && len(prev[i].edges) < 2 {
+			if rng.Float64() < 0.35 {
+				prev[i].edges = append(prev[i].edges, candidate)
+			}
+		}
+	}
+
+	// ensure every next node has an inbound edge
+	incoming := make([]bool, len(next))
+	for _, n := range prev {
+		for _, e := range n.edges {
+			incoming[e] = true
+		}
+	}
+	for idx, ok := range incoming {
+		if ok {
+			continue
+		}
+		p := 0
+		for p+1 < len(prev) && assignments[p+1] < idx {
+			p++
+		}
+		if p+1 < len(prev) && assignments[p+1]-idx < idx-assignments[p] {
+			p++
 		}
+		prev[p].edges = append(prev[p].edges, idx)
+		incoming[idx] = true
 	}
+	for i := range prev {
+		prev[i].edges = sortedEdges(prev[i].edges)
+	}
+}
+
+// sortedEdges orders a node's targets and drops duplicates.
+func sortedEdges(edges []int) []int {
+	out := append([]int{}, edges...)
+	sort.Ints(out)
+	return slices.Compact(out)
 }
 
-func pickTargets(nextCount int, rng *rand.Rand) []int {
-	if nextCount <= 0 {
-		return nil
+// validateAct checks the structure every generated act must have: one boss in
+// the last row, in-range sorted edges without duplicates, no crossing edges,
+// and every node reachable from the first row and able to reach the boss.
+func validateAct(a act) error {
+	if len(a.rows) == 0 {
+		return fmt.Errorf("act %d has no rows", a.index)
 	}
-	maxTargets := 1
-	if nextCount > 1 {
-		maxTargets = 2
+	last := len(a.rows) - 1
+	if len(a.rows[last]) != 1 || a.rows[last][0].kind != nodeBoss {
+		return fmt.Errorf("act %d: last row should be a single boss", a.index)
 	}
-	targetCount := 1 + rng.Intn(maxTargets) // up to maxTargets unique targets
-	targets := make([]int, 0, targetCount)
-	seen := make(map[int]struct{})
-	for len(targets) < targetCount {
-		t := rng.Intn(nextCount)
-		if _, ok := seen[t]; ok {
-			continue
+	for r, row := range a.rows {
+		if len(row) == 0 {
+			return fmt.Errorf("act %d row %d is empty", a.index, r)
+		}
+		for c, n := range row {
+			if n.col != c {
+				return fmt.Errorf("act %d row %d: node %d has col %d", a.index, r, c, n.col)
+			}
+			if n.kind == nodeBoss && r != last {
+				return fmt.Errorf("act %d row %d: boss before the last row", a.index, r)
+			}
+			if r == last {
+				if len(n.edges) > 0 {
+					return fmt.Errorf("act %d: boss has outgoing edges", a.index)
+				}
+				continue
+			}
+			if len(n.edges) == 0 {
+				return fmt.Errorf("act %d row %d col %d: dead end", a.index, r, c)
+			}
+			for i, e := range n.edges {
+				if e < 0 || e >= len(a.rows[r+1]) {
+					return fmt.Errorf("act %d row %d col %d: edge %d out of range", a.index, r, c, e)
+				}
+				if i > 0 && e <= n.edges[i-1] {
+					return fmt.Errorf("act %d row %d col %d: edges %v unsorted or duplicated", a.index, r, c, n.edges)
+				}
+			}
+			if c > 0 {
+				left := row[c-1].edges
+				if len(left) > 0 && left[len(left)-1] > n.edges[0] {
+					return fmt.Errorf("act %d row %d: edges from cols %d and %d cross", a.index, r, c-1, c)
+				}
+			}
 		}
-		seen[t] = struct{}{}
-		targets = append(targets, t)
 	}
-	return targets
+
+	// walk forward from the first row and back from the boss
+	reach := make([][]bool, len(a.rows))
+	for r := range a.rows {
+		reach[r] = make([]bool, len(a.rows[r]))
+	}
+	for c := range reach[0] {
+		reach[0][c] = true
+	}
+	for r := 0; r < last; r++ {
+		for c, n := range a.rows[r] {
+			if reach[r][c] {
+				for _, e := range n.edges {
+					reach[r+1][e] = true
+				}
+			}
+		}
+	}
+	leads := make([][]bool, len(a.rows))
+	for r := range a.rows {
+		leads[r] = make([]bool, len(a.rows[r]))
+	}
+	leads[last][0] = true
+	for r := last - 1; r >= 0; r-- {
+		for c, n := range a.rows[r] {
+			for _, e := range n.edges {
+				leads[r][c] = leads[r][c] || leads[r+1][e]
+			}
+		}
+	}
+	for r := range a.rows {
+		for c := range a.rows[r] {
+			if !reach[r][c] {
+				return fmt.Errorf("act %d row %d col %d is unreachable", a.index, r, c)
+			}
+			if !leads[r][c] {
+				return fmt.Errorf("act %d row %d col %d cannot reach the boss", a.index, r, c)
+			}
+		}
+	}
+	return nil
+}
+
+// jsRound matches Math.round, which rounds halves toward +Inf.
+func jsRound(v float64) int {
+	return int(math.Floor(v + 0.5))
 }
 
 func applyActDifficultyConstraints(actIndex int, songs []song) []song {
@@ -156,8 +314,8 @@ func applyActDifficultyConstraints(actIndex int, songs []song) []song {
 	return filtered
 }
 
-func pickPoolSize(actIndex int, available int, rng *rand.Rand) int {
-	minSize, maxSize := poolBoundsForAct(actIndex)
+func pickPoolSize(cfg runConfig, actIndex int, available int, rng *mulberry32) int {
+	minSize, maxSize := cfg.poolBoundsForAct(actIndex)
 	if available < minSize {
 		return available
 	}
@@ -170,13 +328,31 @@ func pickPoolSize(actIndex int, available int, rng *rand.Rand) int {
 	return minSize + rng.Intn(maxSize-minSize+1)
 }
 
-func poolBoundsForAct(actIndex int) (int, int) {
-	switch actIndex {
-	case 1:
-		return 9, 12
-	case 2:
-		return 6, 9
-	default:
-		return 3, 5
+func pickSelectCount(rng *mulberry32) int {
+	return minSelectable + rng.Intn(maxSelectable-minSelectable+1)
+}
+
+// freshSongs drops songs already offered in the run as long as at least half
+// of the catalog is still unused; past that point repeats are allowed again so
+// small catalogs keep their variety. The web generator applies the same rule.
+func freshSongs(songs []song, used map[string]bool) []song {
+	if len(used) == 0 {
+		return songs
+	}
+	fresh := make([]song, 0, len(songs))
+	for _, s := range songs {
+		if !used[songKey(s)] {
+			fresh = append(fresh, s)
+		}
+	}
+	if len(fresh)*2 < len(songs) {
+		return songs
+	}
+	return fresh
+}
+
+func markUsed(used map[string]bool, songs []song) {
+	for _, s := range songs {
+		used[songKey(s)] = true
 	}
 }
@@ -0,0 +1,75 @@
+// Regenerates the cross-client golden fixture used by both the Go TUI
+// (cmd/longway/main_test.go) and the web generator tests.
+//
+//   node scripts/parity-fixtures.mjs
+import fs from 'node:fs'
+import path from 'node:path'
+import { fileURLToPath } from 'node:url'
+import { generateActs, mulberry32 } from '../src/lib/generator.js'
+
+const dirname = path.dirname(fileURLToPath(import.meta.url))
+const catalogPath = path.resolve(dirname, '../src/data/downloaded_songs.json')
+const outPath = path.resolve(dirname, '../../testdata/parity/generator.json')
+
+const catalogStride = 25
+// whole albums so the artist/album creators have enough tracks to fire
+const fixtureAlbums = new Set([ 'Death Magnetic', 'London Calling', 'Doolittle', 'Tragic Kingdom' ])
+const rngSeeds = [ 0, 1, 42, -5, 1700000000000 ]
+const rngDraws = 8
+const runSeeds = [ 1, 7, 42, 1234, 2026, 1700000000000 ]
+
+export function buildCatalog(raw) {
+  return raw
+    .filter((s) => s.source_included !== false)
+    .filter(
+      (s, idx) => idx % catalogStride === 0 || s.title === 'Bohemian Rhapsody' || fixtureAlbums.has(s.album),
+    )
+    .map((s) => ({
+      id: s.id,
+      title: s.title,
+      artist: s.artist,
+      album: s.album,
+      albumTrack: Number(s.album_track) || 0,
+      origin: s.origin,
+      supports_guitar: Boolean(s.supports_guitar),
+      supports_bass: Boolean(s.supports_bass),
+      supports_drums: Boolean(s.supports_drums),
+      supports_vocals: Boolean(s.supports_vocals),
+      genre: s.genre,
+      year: Number(s.year) || 0,
+      seconds: Number(s.seconds) || 0,
+      difficulty: Math.max(0, Math.min(6, Number(s.difficulty ?? s.diff_band) || 0)),
+    }))
+}
+
+export function serializeActs(acts) {
+  return acts.map((act) => ({
+    index: act.index,
+    rows: act.rows.map((row) =>
+      row.map((node) => ({
+        col: node.col,
+        kind: node.kind,
+        edges: node.edges,
+        selectCount: node.challenge?.selectCount ?? 0,
+        songs: (node.challenge?.songs ?? []).map((s) => s.id),
+      })),
+    ),
+  }))
+}
+
+function main() {
+  const catalog = buildCatalog(JSON.parse(fs.readFileSync(catalogPath, 'utf8')))
+  const rng = rngSeeds.map((seed) => {
+    const next = mulberry32(seed)
+    return { seed, values: Array.from({ length: rngDraws }, () => next()) }
+  })
+  const runs = runSeeds.map((seed) => ({ seed, acts: serializeActs(generateActs(seed, catalog)) }))
+
+  fs.mkdirSync(path.dirname(outPath), { recursive: true })
+  fs.writeFileSync(outPath, JSON.stringify({ catalog, rng, runs }, null, 1) + '\n')
+  console.log(`wrote ${runs.length} runs over ${catalog.length} songs to ${outPath}`)
+}
+
+if (process.argv[1] === fileURLToPath(import.meta.url)) {
+  main()
+}
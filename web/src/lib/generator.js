@@ -0,0 +1,657 @@
+const totalActs = 3
+const rowsPerAct = 7
+const minNodesPerRow = 2
+const maxNodesPerRow = 3
+const minSelectable = 2
+const maxSelectable = 5
+const shopCount = 2
+
+const poolBounds = {
+  1: { min: 9, max: 12 },
+  2: { min: 6, max: 9 },
+  3: { min: 3, max: 5 },
+}
+
+// Relative chance of each creator being tried first, per act; 0 keeps a type
+// out of the act. Mirrors challengeWeights in cmd/longway/challenges.go.
+const challengeWeights = {
+  1: { short: 3, medium: 3, epic: 1, long: 1, decade: 3, difficulty: 2, genre: 3, artist: 1, album: 1, fullAlbum: 1, compound: 0 },
+  2: { short: 2, medium: 2, epic: 2, long: 2, decade: 2, difficulty: 2, genre: 2, artist: 2, album: 2, fullAlbum: 2, compound: 3 },
+  3: { short: 1, medium: 1, epic: 3, long: 3, decade: 1, difficulty: 2, genre: 1, artist: 2, album: 2, fullAlbum: 3, compound: 4 },
+}
+
+export const nodeKinds = {
+  challenge: 'challenge',
+  shop: 'shop',
+  boss: 'boss',
+}
+
+// Pure, catalog-agnostic generator shared with the Go TUI
+// (cmd/longway/world.go). Both clients must produce identical acts for the
+// same seed and catalog; testdata/parity/generator.json pins that contract.
+export function generateActs(seed, catalogSubset) {
+  const rng = mulberry32(seed)
+  const acts = []
+  const used = new Set()
+  for (let i = 0; i < totalActs; i++) {
+    acts.push(generateAct(i + 1, rng, catalogSubset, used))
+  }
+  return acts
+}
+
+// used collects every song offered so far in the run; later nodes draw from
+// the songs not yet offered while enough remain (see freshSongs).
+function generateAct(index, rng, catalogSubset, used) {
+  const filteredSongs = applyActDifficultyConstraints(index, catalogSubset)
+  const actPool = filteredSongs.length ? filteredSongs : catalogSubset
+  const rows = []
+  const shopRows = pickShopRows(rowsPerAct, rng)
+
+  for (let row = 0; row < rowsPerAct; row++) {
+    let maxAllowed = maxNodesPerRow
+    if (row > 0) {
+      maxAllowed = Math.min(maxNodesPerRow, rows[row - 1].length * 2)
+      if (maxAllowed < minNodesPerRow) {
+        maxAllowed = Math.max(1, maxAllowed)
+      }
+    }
+    let count = minNodesPerRow + rngInt(rng, maxNodesPerRow - minNodesPerRow + 1)
+    count = Math.min(count, maxAllowed)
+    if (count < 1) count = 1
+    if (row === rowsPerAct - 1 || shopRows.has(row)) {
+      count = 1 // boss or shop is single node for clarity
+    }
+
+    const nodes = []
+    for (let col = 0; col < count; col++) {
+      const isBoss = row === rowsPerAct - 1
+      const isShop = shopRows.has(row)
+      const poolSize = pickPoolSize(index, actPool.length, rng)
+      const selectCount = pickSelectCount(rng)
+      const node = {
+        col,
+        kind: isBoss ? nodeKinds.boss : isShop ? nodeKinds.shop : nodeKinds.challenge,
+        challenge: isBoss
+          ? bossChallenge(index, catalogSubset)
+          : isShop
+            ? null
+            : challenge(freshSongs(actPool, used), poolSize, selectCount, rng, index),
+        edges: [],
+      }
+      if (node.kind === nodeKinds.challenge) {
+        node.challenge.songs.forEach((s) => used.add(songKey(s)))
+      }
+      nodes.push(node)
+    }
+
+    if (row > 0) {
+      connectRows(rows[row - 1], nodes, rng)
+    }
+
+    rows.push(nodes)
+  }
+
+  return { index, rows }
+}
+
+function connectRows(prev, next, rng) {
+  if (!prev.length || !next.length) return
+
+  const assignments = []
+  for (let i = 0; i < prev.length; i++) {
+    let target = 0
+    if (prev.length > 1) {
+      target = Math.round((i * (next.length - 1)) / (prev.length - 1))
+    }
+    if (assignments.length > 0 && target < assignments[assignments.length - 1]) {
+      target = assignments[assignments.length - 1]
+    }
+    target = Math.min(target, next.length - 1)
+    assignments.push(target)
+    prev[i].edges = [target]
+  }
+
+  // optional second edges to adjacent targets without crossing
+  for (let i = 0; i < prev.length; i++) {
+    const currentTarget = assignments[i]
+    const nextTarget = assignments[i + 1] ?? next.length - 1
+    const candidate = currentTarget + 1
+    if (candidate <= nextTarget && candidate < next.length && prev[i].edges.length < 2) {
+      if (rng() < 0.35) {
+        prev[i].edges.push(candidate)
+      }
+    }
+  }
+
+  // ensure every next node has an inbound edge: attach it to the nearer of
+  // the two previous nodes whose targets bracket it, so edges never cross
+  const incoming = Array(next.length).fill(false)
+  prev.forEach((node) => node.edges.forEach((e) => (incoming[e] = true)))
+  incoming.forEach((covered, idx) => {
+    if (covered) return
+    let p = 0
+    while (p + 1 < prev.length && assignments[p + 1] < idx) p++
+    if (p + 1 < prev.length && assignments[p + 1] - idx < idx - assignments[p]) p++
+    prev[p].edges.push(idx)
+    incoming[idx] = true
+  })
+  prev.forEach((node) => {
+    node.edges = [...new Set(node.edges)].sort((a, b) => a - b)
+  })
+}
+
+function challenge(pool, poolSize, selectCount, rng, actIndex) {
+  const creators = [
+    ['short', shortSongChallenge],
+    ['medium', mediumSongChallenge],
+    ['epic', epicSongChallenge],
+    ['long', longSongChallenge],
+    ['decade', decadeChallenge],
+    ['difficulty', difficultyChallenge],
+    ['genre', genreChallenge],
+    ['artist', artistChallenge],
+    ['album', albumChallenge],
+    ['fullAlbum', fullAlbumChallenge],
+    ['compound', compoundChallenge],
+  ]
+  const table = challengeWeights[actIndex] ?? challengeWeights[totalActs]
+  const order = weightedOrder(
+    creators.map(([type]) => table[type] ?? 0),
+    rng,
+  )
+  for (const idx of order) {
+    const c = creators[idx][1](pool, poolSize, rng, actIndex, selectCount)
+    if (c) return c
+  }
+  const songs = sample(pool, Math.max(selectCount, poolSize), rng)
+  const finalSelect = clampSelectCount(selectCount, songs.length)
+  return {
+    name: 'Challenge',
+    summary: summaryForSongs(songs.length, finalSelect),
+    songs,
+    selectCount: finalSelect,
+    goal: actGoal(actIndex),
+  }
+}
+
+function bossChallenge(actIndex, pool) {
+  const boss = pool.find((s) => s.title === 'Bohemian Rhapsody') ?? pool[0]
+  return {
+    name: 'Boss',
+    summary: 'Final showdown: Bohemian Rhapsody.',
+    songs: [boss],
+    selectCount: 1,
+    goal: actGoal(actIndex),
+  }
+}
+
+function applyActDifficultyConstraints(actIndex, songs) {
+  return songs.filter((s) => {
+    if (actIndex === 1) return s.difficulty <= 3
+    if (actIndex === 2) return s.difficulty <= 5
+    return s.difficulty >= 3
+  })
+}
+
+function pickPoolSize(actIndex, available, rng) {
+  const bounds = poolBounds[actIndex] ?? poolBounds[3]
+  const min = Math.min(bounds.min, available)
+  const max = Math.min(bounds.max, available)
+  if (min >= max) return min
+  return min + rngInt(rng, max - min + 1)
+}
+
+function pickSelectCount(rng) {
+  return minSelectable + rngInt(rng, maxSelectable - minSelectable + 1)
+}
+
+function sample(pool, count, rng) {
+  if (pool.length <= count) return [...pool]
+  const indices = pickDistinct(pool.length, count, rng)
+  return indices.map((i) => pool[i])
+}
+
+function summaryForSongs(poolSize, selectCount, suffix = '') {
+  const tail = suffix ? ` ${suffix}` : ''
+  return `Pick ${selectCount} of these ${poolSize} tracks${tail}.`
+}
+
+function actGoal(actIndex) {
+  if (actIndex === 1) return 3
+  if (actIndex === 2) return 4
+  if (actIndex === 3) return 5
+  return 5
+}
+
+// exports for path.js and tests
+export {
+  mulberry32,
+  connectRows,
+  weightedOrder,
+  challengeWeights,
+  freshSongs,
+  clampDifficulty,
+  shortSongChallenge,
+  mediumSongChallenge,
+  epicSongChallenge,
+  genreChallenge,
+  artistChallenge,
+  albumChallenge,
+  fullAlbumChallenge,
+  compoundChallenge,
+  actGoal,
+  pickSelectCount,
+  clampSelectCount,
+}
+
+function decadeChallenge(pool, poolSize, rng, actIndex, selectCount) {
+  const byDecade = pool.reduce((acc, s) => {
+    if (!s.year) return acc
+    const dec = Math.floor(s.year / 10) * 10
+    acc[dec] = acc[dec] || []
+    acc[dec].push(s)
+    return acc
+  }, {})
+  const eligible = Object.entries(byDecade).filter(([, list]) => list.length >= 3)
+  if (!eligible.length) return null
+  const [decade, list] = eligible[rngInt(rng, eligible.length)]
+  const sampleSize = Math.max(selectCount, Math.min(poolSize, list.length))
+  const songs = sample(list, sampleSize, rng)
+  const finalSelect = clampSelectCount(selectCount, songs.length)
+  return {
+    name: 'DecadeChallenge',
+    summary: summaryForSongs(songs.length, finalSelect, `from the ${decade}s`),
+    songs,
+    selectCount: finalSelect,
+    goal: actGoal(actIndex),
+  }
+}
+
+function difficultyChallenge(pool, poolSize, rng, actIndex, selectCount) {
+  const byLevel = pool.reduce((acc, s) => {
+    const level = clampDifficulty(s.difficulty)
+    acc[level] = acc[level] || []
+    acc[level].push(s)
+    return acc
+  }, {})
+  const eligible = Object.entries(byLevel).filter(([, list]) => list.length >= 3)
+  if (!eligible.length) return null
+  const [level, list] = eligible[rngInt(rng, eligible.length)]
+  const sampleSize = Math.max(selectCount, Math.min(poolSize, list.length))
+  const songs = sample(list, sampleSize, rng)
+  const finalSelect = clampSelectCount(selectCount, songs.length)
+  return {
+    name: 'DifficultyChallenge',
+    summary: summaryForSongs(songs.length, finalSelect, `at difficulty ${level}`),
+    songs,
+    selectCount: finalSelect,
+    goal: actGoal(actIndex),
+  }
+}
+
+function genreChallenge(pool, poolSize, rng, actIndex, selectCount) {
+  const byGenre = pool.reduce((acc, s) => {
+    if (!s.genre) return acc
+    const key = s.genre.toLowerCase()
+    acc[key] = acc[key] || []
+    acc[key].push(s)
+    return acc
+  }, {})
+  const eligible = Object.entries(byGenre).filter(([, list]) => list.length >= 3)
+  if (!eligible.length) return null
+  const [genre, list] = eligible[rngInt(rng, eligible.length)]
+  const sampleSize = Math.max(selectCount, Math.min(poolSize, list.length))
+  const songs = sample(list, sampleSize, rng)
+  const finalSelect = clampSelectCount(selectCount, songs.length)
+  return {
+    name: 'GenreChallenge',
+    summary: summaryForSongs(songs.length, finalSelect, `in ${genre}`),
+    songs,
+    selectCount: finalSelect,
+    goal: actGoal(actIndex),
+  }
+}
+
+// Groups songs by key in first-seen order; Map keeps numeric-looking keys
+// (album "1984") in insertion order, matching groupSongs in the Go TUI.
+function groupSongs(pool, keyFn) {
+  const groups = new Map()
+  pool.forEach((s) => {
+    const key = keyFn(s)
+    if (!key) return
+    if (!groups.has(key)) groups.set(key, [])
+    groups.get(key).push(s)
+  })
+  return [...groups.entries()].filter(([, list]) => list.length >= 3)
+}
+
+function albumKey(s) {
+  if (!s.album || !s.artist) return ''
+  return `${s.artist} — ${s.album}`
+}
+
+function artistChallenge(pool, poolSize, rng, actIndex, selectCount) {
+  const eligible = groupSongs(pool, (s) => s.artist)
+  if (!eligible.length) return null
+  const [artist, list] = eligible[rngInt(rng, eligible.length)]
+  const sampleSize = Math.max(selectCount, Math.min(poolSize, list.length))
+  const songs = sample(list, sampleSize, rng)
+  const finalSelect = clampSelectCount(selectCount, songs.length)
+  return {
+    name: 'ArtistChallenge',
+    summary: summaryForSongs(songs.length, finalSelect, `by ${artist}`),
+    songs,
+    selectCount: finalSelect,
+    goal: actGoal(actIndex),
+  }
+}
+
+function albumChallenge(pool, poolSize, rng, actIndex, selectCount) {
+  const eligible = groupSongs(pool, albumKey)
+  if (!eligible.length) return null
+  const [, list] = eligible[rngInt(rng, eligible.length)]
+  const sampleSize = Math.max(selectCount, Math.min(poolSize, list.length))
+  const songs = sample(list, sampleSize, rng)
+  const finalSelect = clampSelectCount(selectCount, songs.length)
+  return {
+    name: 'AlbumChallenge',
+    summary: summaryForSongs(songs.length, finalSelect, `from ${list[0].album} by ${list[0].artist}`),
+    songs,
+    selectCount: finalSelect,
+    goal: actGoal(actIndex),
+  }
+}
+
+// A consecutive run of an album's tracks, played in album_track order.
+function fullAlbumChallenge(pool, poolSize, rng, actIndex) {
+  const eligible = groupSongs(pool, (s) => (s.albumTrack > 0 ? albumKey(s) : ''))
+  if (!eligible.length) return null
+  const [, list] = eligible[rngInt(rng, eligible.length)]
+  const tracks = [...list].sort((a, b) => a.albumTrack - b.albumTrack)
+  const size = Math.min(tracks.length, Math.max(3, poolSize))
+  const start = rngInt(rng, tracks.length - size + 1)
+  const songs = tracks.slice(start, start + size)
+  return {
+    name: 'FullAlbumChallenge',
+    summary: `Play all ${songs.length} of these tracks from ${songs[0].album} by ${songs[0].artist}, in album order.`,
+    songs,
+    selectCount: songs.length,
+    ordered: true,
+    goal: actGoal(actIndex),
+  }
+}
+
+// Facets a compound challenge can stack, in name order. Mirrors
+// compoundFacets in cmd/longway/compound.go.
+const compoundFacets = [
+  {
+    id: 'decade',
+    values: (s) => (s.year ? [String(Math.floor(s.year / 10) * 10)] : []),
+    label: (key) => [`${key.slice(-2)}s`, `from the ${key}s`],
+  },
+  {
+    id: 'genre',
+    values: (s) => (s.genre ? [s.genre.toLowerCase()] : []),
+    label: (_, example) => [example.genre, `in ${example.genre}`],
+  },
+  {
+    id: 'tier',
+    values: (s) => [String(clampDifficulty(s.difficulty))],
+    label: (key) => [`tier ${key}`, `at difficulty ${key}`],
+  },
+  {
+    id: 'part',
+    values: (s) =>
+      [
+        ['guitar', s.supports_guitar],
+        ['bass', s.supports_bass],
+        ['drums', s.supports_drums],
+        ['vocals', s.supports_vocals],
+      ]
+        .filter(([, ok]) => ok)
+        .map(([name]) => name),
+    label: (key) => [`with ${key}`, `with a ${key} part`],
+  },
+  {
+    id: 'origin',
+    values: (s) => (s.origin ? [s.origin] : []),
+    label: (key) => [`from ${key}`, `from ${key}`],
+  },
+  {
+    id: 'length',
+    values: (s) => {
+      if (!(s.seconds > 0)) return []
+      if (s.seconds <= 150) return ['short']
+      if (s.seconds < 300) return ['medium']
+      if (s.seconds > 300) return ['long']
+      return []
+    },
+    label: (key) => {
+      if (key === 'short') return ['under 2:30', 'of 2:30 or less']
+      if (key === 'medium') return ['from 2:31 to 4:59', 'from 2:31 to 4:59']
+      return ['over 5 minutes', 'over 5 minutes']
+    },
+  },
+]
+
+// Stacks two predicates in act 2 and two or three in act 3, narrowing the
+// pool after each; a predicate is only taken if enough songs survive it.
+function compoundChallenge(pool, poolSize, rng, actIndex, selectCount) {
+  if (actIndex < 2) return null
+  let want = 2
+  if (actIndex >= 3) want += rngInt(rng, 2)
+  const need = Math.max(3, selectCount)
+
+  let candidates = pool
+  const chosen = []
+  const order = shuffle(
+    compoundFacets.map((_, i) => i),
+    rng,
+  )
+  for (const fi of order) {
+    if (chosen.length === want) break
+    const groups = new Map()
+    candidates.forEach((s) => {
+      compoundFacets[fi].values(s).forEach((v) => {
+        if (!groups.has(v)) groups.set(v, [])
+        groups.get(v).push(s)
+      })
+    })
+    const eligible = [...groups.entries()].filter(([, list]) => list.length >= need)
+    if (!eligible.length) continue
+    const [key, list] = eligible[rngInt(rng, eligible.length)]
+    candidates = list
+    chosen.push({ facet: fi, key, example: list[0] })
+  }
+  if (chosen.length < 2) return null
+
+  const sampleSize = Math.max(selectCount, Math.min(poolSize, candidates.length))
+  const songs = sample(candidates, sampleSize, rng)
+  const finalSelect = clampSelectCount(selectCount, songs.length)
+  const labels = [...chosen]
+    .sort((a, b) => a.facet - b.facet)
+    .map((c) => compoundFacets[c.facet].label(c.key, c.example))
+  const name = labels.map(([short]) => short).join(' ')
+  return {
+    name: name.charAt(0).toUpperCase() + name.slice(1),
+    summary: summaryForSongs(
+      songs.length,
+      finalSelect,
+      labels.map(([, long]) => long).join(', '),
+    ),
+    songs,
+    selectCount: finalSelect,
+    goal: actGoal(actIndex),
+  }
+}
+
+function longSongChallenge(pool, poolSize, rng, actIndex, selectCount) {
+  const longSongs = pool.filter((s) => s.seconds > 300)
+  if (longSongs.length < 3) return null
+  const sampleSize = Math.max(selectCount, Math.min(poolSize, longSongs.length))
+  const songs = sample(longSongs, sampleSize, rng)
+  const finalSelect = clampSelectCount(selectCount, songs.length)
+  return {
+    name: 'SongLengthChallenge',
+    summary: summaryForSongs(songs.length, finalSelect, 'over 5 minutes'),
+    songs,
+    selectCount: finalSelect,
+    goal: actGoal(actIndex),
+  }
+}
+
+function shortSongChallenge(pool, poolSize, rng, actIndex, selectCount) {
+  const shorts = pool.filter((s) => s.seconds > 0 && s.seconds <= 150)
+  if (shorts.length < 3) return null
+  const sampleSize = Math.max(selectCount, Math.min(poolSize, shorts.length))
+  const songs = sample(shorts, sampleSize, rng)
+  const finalSelect = clampSelectCount(selectCount, songs.length)
+  return {
+    name: 'ShortSongChallenge',
+    summary: summaryForSongs(songs.length, finalSelect, 'under 2:30'),
+    songs,
+    selectCount: finalSelect,
+    goal: actGoal(actIndex),
+  }
+}
+
+function mediumSongChallenge(pool, poolSize, rng, actIndex, selectCount) {
+  const mediums = pool.filter((s) => s.seconds > 150 && s.seconds < 300)
+  if (mediums.length < 3) return null
+  const sampleSize = Math.max(selectCount, Math.min(poolSize, mediums.length))
+  const songs = sample(mediums, sampleSize, rng)
+  const finalSelect = clampSelectCount(selectCount, songs.length)
+  return {
+    name: 'MediumSongChallenge',
+    summary: summaryForSongs(songs.length, finalSelect, '2:31 – 4:59'),
+    songs,
+    selectCount: finalSelect,
+    goal: actGoal(actIndex),
+  }
+}
+
+function epicSongChallenge(pool, poolSize, rng, actIndex, selectCount) {
+  const epics = pool.filter((s) => s.seconds >= 420)
+  if (epics.length < 3) return null
+  const sampleSize = Math.max(selectCount, Math.min(poolSize, epics.length))
+  const songs = sample(epics, sampleSize, rng)
+  const finalSelect = clampSelectCount(selectCount, songs.length)
+  return {
+    name: 'EpicSongChallenge',
+    summary: summaryForSongs(songs.length, finalSelect, 'over 7 minutes'),
+    songs,
+    selectCount: finalSelect,
+    goal: actGoal(actIndex),
+  }
+}
+
+function pickDistinct(size, count, rng, existing = new Set()) {
+  const seen = new Set()
+  existing.forEach((v) => seen.add(v))
+  const picks = []
+  let safety = 0
+  const maxAttempts = size * 3
+  while (picks.length < count && safety < maxAttempts) {
+    const v = rngInt(rng, size)
+    if (seen.has(v)) continue
+    seen.add(v)
+    picks.push(v)
+    safety++
+  }
+  return picks
+}
+
+function rngInt(rng, maxExclusive) {
+  return Math.floor(rng() * maxExclusive)
+}
+
+// deterministic PRNG
+function mulberry32(seed) {
+  let t = seed + 0x6d2b79f5
+  return function () {
+    t = Math.imul(t ^ (t >>> 15), t | 1)
+    t ^= t + Math.imul(t ^ (t >>> 7), t | 61)
+    return ((t ^ (t >>> 14)) >>> 0) / 4294967296
+  }
+}
+
+function shuffle(arr, rng) {
+  const a = [...arr]
+  for (let i = a.length - 1; i > 0; i--) {
+    const j = Math.floor(rng() * (i + 1))
+    ;[a[i], a[j]] = [a[j], a[i]]
+  }
+  return a
+}
+
+// Drops songs already offered in the run while at least half of the catalog is
+// unused; past that, repeats are allowed again. Mirrors freshSongs in
+// cmd/longway/world.go.
+function freshSongs(songs, used) {
+  if (used.size === 0) return songs
+  const fresh = songs.filter((s) => !used.has(songKey(s)))
+  return fresh.length * 2 < songs.length ? songs : fresh
+}
+
+function songKey(s) {
+  return s.id || `${s.title}|${s.artist}`
+}
+
+// Draws indices without replacement in proportion to their weights; indices
+// weighted 0 are left out. Mirrors weightedOrder in cmd/longway/rng.go.
+function weightedOrder(weights, rng) {
+  const left = []
+  weights.forEach((w, i) => {
+    if (w > 0) left.push(i)
+  })
+  const order = []
+  while (left.length > 1) {
+    const total = left.reduce((sum, i) => sum + weights[i], 0)
+    let roll = Math.floor(rng() * total)
+    let pick = left.length - 1
+    for (let k = 0; k < left.length; k++) {
+      roll -= weights[left[k]]
+      if (roll < 0) {
+        pick = k
+        break
+      }
+    }
+    order.push(left[pick])
+    left.splice(pick, 1)
+  }
+  return order.concat(left)
+}
+
+function clampDifficulty(d) {
+  if (Number.isNaN(d)) return 0
+  return Math.max(0, Math.min(6, d))
+}
+
+// leave at least one song unpicked so there is always a choice to make
+function clampSelectCount(count, songsLength) {
+  return Math.max(1, Math.min(count, songsLength - 1))
+}
+
+function pickShopRows(totalRows, rng) {
+  const shops = new Set()
+  const candidateRows = []
+  for (let r = 1; r < totalRows - 1; r++) {
+    candidateRows.push(r)
+  }
+  const maxAttempts = 50
+  let attempts = 0
+  while (shops.size < shopCount && attempts < maxAttempts) {
+    const row = candidateRows[rngInt(rng, candidateRows.length)]
+    if (shops.has(row) || shops.has(row - 1) || shops.has(row + 1)) {
+      attempts++
+      continue
+    }
+    shops.add(row)
+  }
+  for (let i = 0; shops.size < shopCount && i < candidateRows.length; i++) {
+    const r = candidateRows[i]
+    if (shops.has(r) || shops.has(r - 1) || shops.has(r + 1)) continue
+    shops.add(r)
+  }
+  return shops
+}
@@ -0,0 +1,135 @@
+import fs from 'node:fs'
+import path from 'node:path'
+import { fileURLToPath } from 'node:url'
+import { describe, expect, it } from 'vitest'
+import {
+  albumChallenge,
+  artistChallenge,
+  compoundChallenge,
+  fullAlbumChallenge,
+  challengeWeights,
+  connectRows,
+  freshSongs,
+  generateActs,
+  mulberry32,
+  weightedOrder,
+} from './generator'
+import { serializeActs } from '../../scripts/parity-fixtures.mjs'
+
+const dirname = path.dirname(fileURLToPath(import.meta.url))
+const fixture = JSON.parse(
+  fs.readFileSync(path.resolve(dirname, '../../../testdata/parity/generator.json'), 'utf8'),
+)
+
+describe('cross-client parity fixture', () => {
+  it('reproduces the shared mulberry32 draws', () => {
+    fixture.rng.forEach(({ seed, values }) => {
+      const rng = mulberry32(seed)
+      values.forEach((value) => expect(rng()).toBe(value))
+    })
+  })
+
+  it('generates the same acts as the Go TUI for each seed', () => {
+    fixture.runs.forEach(({ seed, acts }) => {
+      expect(serializeActs(generateActs(seed, fixture.catalog))).toEqual(acts)
+    })
+  })
+})
+
+describe('album challenges', () => {
+  const album = Array.from({ length: 6 }, (_, i) => ({
+    id: `dm${i}`,
+    title: `Magnetic ${i}`,
+    artist: 'Metallica',
+    album: 'Death Magnetic',
+    albumTrack: 6 - i,
+  }))
+
+  it('plays a full album run in album_track order', () => {
+    const c = fullAlbumChallenge(album, 4, mulberry32(9), 1)
+    expect(c.ordered).toBe(true)
+    expect(c.selectCount).toBe(c.songs.length)
+    c.songs.slice(1).forEach((s, i) => expect(s.albumTrack).toBe(c.songs[i].albumTrack + 1))
+  })
+
+  it('keeps artist and album pools to one source', () => {
+    const artist = artistChallenge(album, 4, mulberry32(9), 1, 2)
+    expect(artist.songs.every((s) => s.artist === 'Metallica')).toBe(true)
+    const fromAlbum = albumChallenge(album, 4, mulberry32(9), 1, 2)
+    expect(fromAlbum.summary).toBe('Pick 2 of these 4 tracks from Death Magnetic by Metallica.')
+  })
+})
+
+describe('compound challenges', () => {
+  const pool = Array.from({ length: 60 }, (_, i) => ({
+    id: `c${i}`,
+    title: `Compound ${i}`,
+    genre: ['Metal', 'Rock'][i % 2],
+    year: 1980 + (i % 3) * 10,
+    seconds: 200 + (i % 2) * 200,
+    difficulty: i % 4,
+    supports_guitar: true,
+  }))
+
+  it('keeps act 1 to single-attribute challenges', () => {
+    expect(compoundChallenge(pool, 9, mulberry32(1), 1, 3)).toBeNull()
+  })
+
+  it('names the stacked predicates', () => {
+    const c = compoundChallenge(pool, 5, mulberry32(4), 2, 3)
+    expect(c.name.length).toBeGreaterThan(0)
+    expect(c.songs.length).toBeGreaterThanOrEqual(3)
+    expect(c.summary.startsWith(`Pick 3 of these ${c.songs.length} tracks `)).toBe(true)
+  })
+})
+
+describe('weighted challenge order', () => {
+  it('drops zero weights and favours heavy entries', () => {
+    const first = [0, 0, 0, 0]
+    for (let seed = 0; seed < 2000; seed++) {
+      const order = weightedOrder([4, 0, 1, 2], mulberry32(seed))
+      expect([...order].sort()).toEqual([0, 2, 3])
+      first[order[0]]++
+    }
+    expect(first[0]).toBeGreaterThan(1000)
+    expect(first[2]).toBeLessThan(380)
+  })
+
+  it('keeps compound challenges out of act 1', () => {
+    expect(challengeWeights[1].compound).toBe(0)
+    expect(challengeWeights[3].compound).toBeGreaterThan(challengeWeights[2].compound)
+  })
+})
+
+describe('repeat avoidance', () => {
+  const songs = ['a', 'b', 'c', 'd'].map((id) => ({ id, title: id, artist: 'X' }))
+
+  it('drops offered songs while half the catalog is unused', () => {
+    expect(freshSongs(songs, new Set(['a', 'b'])).map((s) => s.id)).toEqual(['c', 'd'])
+  })
+
+  it('allows repeats once most of the catalog is used', () => {
+    expect(freshSongs(songs, new Set(['a', 'b', 'c']))).toHaveLength(4)
+  })
+})
+
+describe('row wiring', () => {
+  const row = (n) => Array.from({ length: n }, (_, col) => ({ col, edges: [] }))
+
+  it('covers wide rows without crossing or duplicate edges', () => {
+    for (let seed = 1; seed <= 500; seed++) {
+      for (const [from, to] of [[1, 2], [2, 4], [3, 6], [4, 1], [5, 3]]) {
+        const prev = row(from)
+        connectRows(prev, row(to), mulberry32(seed))
+        const covered = new Set(prev.flatMap((n) => n.edges))
+        expect(covered.size).toBe(to)
+        prev.forEach((n, i) => {
+          expect(n.edges.length).toBeGreaterThan(0)
+          expect(new Set(n.edges).size).toBe(n.edges.length)
+          expect([...n.edges].sort((a, b) => a - b)).toEqual(n.edges)
+          if (i > 0) expect(prev[i - 1].edges.at(-1)).toBeLessThanOrEqual(n.edges[0])
+        })
+      }
+    }
+  })
+})